@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"maki/compiler"
+	"maki/vm"
+	"sort"
+	"strings"
+	"time"
+)
+
+// benchmark is a bench_ function of a script, ready to be called.
+type benchmark struct {
+	name string
+	run  func() error
+}
+
+// benchFiles implements `maki bench [-time d] files...`: it runs the bench_
+// functions of the files repeatedly, for at least the given time, and
+// reports the time taken by each call.
+func benchFiles(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	d := flags.Duration("time", time.Second, "minimum time to run each benchmark for")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		return errors.New("Usage: maki bench [-time d] files...")
+	}
+
+	var failed []string
+	for _, path := range flags.Args() {
+		if flags.NArg() > 1 {
+			_, _ = fmt.Fprintf(stdout, "%s:\n", path)
+		}
+		if err := benchFile(path, *d, stdout); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", path, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+func benchFile(path string, d time.Duration, stdout io.Writer) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	source := string(b)
+	bs, err := benchmarks(source)
+	if err != nil {
+		return errors.New(report(err, source))
+	}
+	if len(bs) == 0 {
+		return errors.New("no bench_ functions found")
+	}
+
+	for _, b := range bs {
+		n, op, err := measure(b, d)
+		if err != nil {
+			return errors.New(report(err, source))
+		}
+		_, _ = fmt.Fprintf(stdout, "%-24s %10d %12d ns/op\n", b.name, n, op.Nanoseconds())
+	}
+	return nil
+}
+
+// benchmarks runs source, whose output is discarded, and returns the global
+// functions named bench_ taking no arguments, sorted by name.
+func benchmarks(source string) ([]benchmark, error) {
+	c := compiler.NewCompiler(compiler.Optimize(optimize))
+	machine := vm.NewVM(vm.Stdout(ioutil.Discard))
+	if err := interpret(c, machine, source); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, v := range machine.Globals() {
+		if f, ok := v.Ptr.(*vm.Function); ok && strings.HasPrefix(name, "bench_") && f.Arity == 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	bs := make([]benchmark, 0, len(names))
+	for _, name := range names {
+		fun, err := c.CompileExpression(name + "()")
+		if err != nil {
+			return nil, err
+		}
+
+		bs = append(bs, benchmark{
+			name: name,
+			run: func() error {
+				_, err := machine.Eval(fun)
+				return err
+			},
+		})
+	}
+	return bs, nil
+}
+
+// measure calls b repeatedly for at least d, like `go test -bench` does,
+// returning the number of calls and the time taken by each one.
+func measure(b benchmark, d time.Duration) (int, time.Duration, error) {
+	n := 1
+	for {
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			if err := b.run(); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		elapsed := time.Since(start)
+		if elapsed >= d || n >= 1e9 {
+			return n, elapsed / time.Duration(n), nil
+		}
+
+		// predict the calls needed to last d, growing 100x at most
+		next := n * 100
+		if elapsed > 0 {
+			if predicted := int(int64(n) * int64(d) / int64(elapsed) * 6 / 5); predicted < next {
+				next = predicted
+			}
+		}
+		if next <= n {
+			next = n + 1
+		}
+		n = next
+	}
+}
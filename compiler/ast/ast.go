@@ -0,0 +1,348 @@
+// Package ast declares the types used to represent the syntax tree of Maki
+// source code.
+package ast
+
+// Position locates a token in source code.
+type Position struct {
+	Line   int
+	Column int
+	Offset int // position of the first character in source
+	Length int // number of characters, quotes included
+}
+
+// IsValid reports whether the position is set.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Node is implemented by all the nodes of the tree.
+type Node interface {
+	Pos() Position // first token of the node
+	End() Position // last token of the node
+}
+
+// Expr is implemented by all the expression nodes.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Stmt is implemented by all the statement nodes.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Kind is the kind of a literal.
+type Kind uint8
+
+const (
+	Nil Kind = iota
+	False
+	True
+	Number
+	String
+)
+
+// Expressions
+
+type (
+	// Ident is an identifier, e.g. the name of a variable.
+	Ident struct {
+		NamePos Position
+		Name    string
+	}
+
+	// Literal is a number, a string, a boolean or nil.
+	Literal struct {
+		ValuePos Position
+		Kind     Kind
+		Value    string // as written in source, strings without quotes
+	}
+
+	// Interpolation is a string with embedded expressions, e.g.
+	// "Hello ${name}". Parts alternate string literals, empty ones included,
+	// and expressions, starting and ending with a literal.
+	Interpolation struct {
+		Parts []Expr
+	}
+
+	// Array is an array literal, e.g. [1, 2, 3].
+	Array struct {
+		Lsquare  Position
+		Elements []Expr
+		Rsquare  Position
+	}
+
+	// Grouping is an expression in parentheses.
+	Grouping struct {
+		Lparen Position
+		Expr   Expr
+		Rparen Position
+	}
+
+	// Unary is a prefix operator applied to its operand, e.g. -x.
+	Unary struct {
+		OpPos   Position
+		Op      string
+		Operand Expr
+	}
+
+	// Binary is an infix operator, logical ones included, e.g. x + y.
+	Binary struct {
+		Left  Expr
+		OpPos Position
+		Op    string
+		Right Expr
+	}
+
+	// Conditional chooses between two expressions, e.g. c ? x : y.
+	Conditional struct {
+		Cond     Expr
+		Question Position
+		Then     Expr
+		Colon    Position
+		Else     Expr
+	}
+
+	// Call is a function call, e.g. f(x, y).
+	Call struct {
+		Callee Expr
+		Lparen Position
+		Args   []Expr
+		Rparen Position
+	}
+
+	// Index is an element of an array, e.g. xs[0].
+	Index struct {
+		Object  Expr
+		Lsquare Position
+		Index   Expr
+		Rsquare Position
+	}
+
+	// Slice is a part of a string, e.g. s[1:3], s[:3] or s[1:]. Missing
+	// bounds are nil.
+	Slice struct {
+		Object  Expr
+		Lsquare Position
+		Low     Expr
+		Colon   Position
+		High    Expr
+		Rsquare Position
+	}
+
+	// Property is a property of a value, e.g. s.upper.
+	Property struct {
+		Object Expr
+		Dot    Position
+		Name   *Ident
+	}
+
+	// Assign is an assignment to a variable or to an element, e.g. x = 1,
+	// x += 1 or x++.
+	Assign struct {
+		Target Expr // Ident or Index
+		OpPos  Position
+		Op     string // =, +=, -=, *=, /=, ++ or --
+		Value  Expr   // nil for ++ and --
+	}
+)
+
+func (e *Ident) Pos() Position         { return e.NamePos }
+func (e *Literal) Pos() Position       { return e.ValuePos }
+func (e *Interpolation) Pos() Position { return e.Parts[0].Pos() }
+func (e *Array) Pos() Position         { return e.Lsquare }
+func (e *Grouping) Pos() Position      { return e.Lparen }
+func (e *Unary) Pos() Position         { return e.OpPos }
+func (e *Binary) Pos() Position        { return e.Left.Pos() }
+func (e *Conditional) Pos() Position   { return e.Cond.Pos() }
+func (e *Call) Pos() Position          { return e.Callee.Pos() }
+func (e *Index) Pos() Position         { return e.Object.Pos() }
+func (e *Slice) Pos() Position         { return e.Object.Pos() }
+func (e *Property) Pos() Position      { return e.Object.Pos() }
+func (e *Assign) Pos() Position        { return e.Target.Pos() }
+
+func (e *Ident) End() Position         { return e.NamePos }
+func (e *Literal) End() Position       { return e.ValuePos }
+func (e *Interpolation) End() Position { return e.Parts[len(e.Parts)-1].End() }
+func (e *Array) End() Position         { return e.Rsquare }
+func (e *Grouping) End() Position      { return e.Rparen }
+func (e *Unary) End() Position         { return e.Operand.End() }
+func (e *Binary) End() Position        { return e.Right.End() }
+func (e *Conditional) End() Position   { return e.Else.End() }
+func (e *Call) End() Position          { return e.Rparen }
+func (e *Index) End() Position         { return e.Rsquare }
+func (e *Slice) End() Position         { return e.Rsquare }
+func (e *Property) End() Position      { return e.Name.NamePos }
+func (e *Assign) End() Position {
+	if e.Value == nil {
+		return e.OpPos
+	}
+	return e.Value.End()
+}
+
+func (*Ident) exprNode()         {}
+func (*Literal) exprNode()       {}
+func (*Interpolation) exprNode() {}
+func (*Array) exprNode()         {}
+func (*Grouping) exprNode()      {}
+func (*Unary) exprNode()         {}
+func (*Binary) exprNode()        {}
+func (*Conditional) exprNode()   {}
+func (*Call) exprNode()          {}
+func (*Index) exprNode()         {}
+func (*Slice) exprNode()         {}
+func (*Property) exprNode()      {}
+func (*Assign) exprNode()        {}
+
+// Statements
+
+type (
+	// ExprStmt is an expression whose value is discarded.
+	ExprStmt struct {
+		Expr Expr
+	}
+
+	// PrintStmt is a print statement.
+	PrintStmt struct {
+		Print Position
+		Expr  Expr
+	}
+
+	// AssertStmt is an assert statement.
+	AssertStmt struct {
+		Assert Position
+		Expr   Expr
+	}
+
+	// ReturnStmt is a return statement.
+	ReturnStmt struct {
+		Return Position
+		Result Expr
+	}
+
+	// VarStmt declares one or more variables, using var or let.
+	VarStmt struct {
+		Keyword    Position
+		Modifiable bool     // declared with var
+		Lbrace     Position // not valid for a single declaration
+		Specs      []*VarSpec
+		Rbrace     Position // not valid for a single declaration
+	}
+
+	// VarSpec is a single variable of a declaration.
+	VarSpec struct {
+		Name  *Ident
+		Value Expr // nil if not initialized
+	}
+
+	// FunStmt is a function declaration.
+	FunStmt struct {
+		Fun    Position
+		Name   *Ident
+		Params []*Ident
+		Body   *BlockStmt
+	}
+
+	// BlockStmt is a list of statements in braces.
+	BlockStmt struct {
+		Lbrace     Position
+		Statements []Stmt
+		Rbrace     Position
+	}
+
+	// IfStmt is an if statement.
+	IfStmt struct {
+		If   Position
+		Cond Expr
+		Then *BlockStmt
+		Else *BlockStmt // nil if there is no else branch
+	}
+
+	// WhileStmt is a while loop.
+	WhileStmt struct {
+		While Position
+		Cond  Expr
+		Body  Stmt
+	}
+
+	// ForStmt is a for loop.
+	ForStmt struct {
+		For  Position
+		Init Stmt // nil if there is no initializer
+		Cond Expr
+		Post Expr
+		Body Stmt
+	}
+)
+
+func (s *ExprStmt) Pos() Position   { return s.Expr.Pos() }
+func (s *PrintStmt) Pos() Position  { return s.Print }
+func (s *AssertStmt) Pos() Position { return s.Assert }
+func (s *ReturnStmt) Pos() Position { return s.Return }
+func (s *VarStmt) Pos() Position    { return s.Keyword }
+func (s *VarSpec) Pos() Position    { return s.Name.Pos() }
+func (s *FunStmt) Pos() Position    { return s.Fun }
+func (s *BlockStmt) Pos() Position  { return s.Lbrace }
+func (s *IfStmt) Pos() Position     { return s.If }
+func (s *WhileStmt) Pos() Position  { return s.While }
+func (s *ForStmt) Pos() Position    { return s.For }
+
+func (s *ExprStmt) End() Position   { return s.Expr.End() }
+func (s *PrintStmt) End() Position  { return s.Expr.End() }
+func (s *AssertStmt) End() Position { return s.Expr.End() }
+func (s *ReturnStmt) End() Position { return s.Result.End() }
+func (s *FunStmt) End() Position    { return s.Body.End() }
+func (s *BlockStmt) End() Position  { return s.Rbrace }
+func (s *WhileStmt) End() Position  { return s.Body.End() }
+func (s *ForStmt) End() Position    { return s.Body.End() }
+
+func (s *VarStmt) End() Position {
+	if s.Rbrace.IsValid() {
+		return s.Rbrace
+	}
+	return s.Specs[len(s.Specs)-1].End()
+}
+
+func (s *VarSpec) End() Position {
+	if s.Value != nil {
+		return s.Value.End()
+	}
+	return s.Name.End()
+}
+
+func (s *IfStmt) End() Position {
+	if s.Else != nil {
+		return s.Else.End()
+	}
+	return s.Then.End()
+}
+
+func (*ExprStmt) stmtNode()   {}
+func (*PrintStmt) stmtNode()  {}
+func (*AssertStmt) stmtNode() {}
+func (*ReturnStmt) stmtNode() {}
+func (*VarStmt) stmtNode()    {}
+func (*FunStmt) stmtNode()    {}
+func (*BlockStmt) stmtNode()  {}
+func (*IfStmt) stmtNode()     {}
+func (*WhileStmt) stmtNode()  {}
+func (*ForStmt) stmtNode()    {}
+
+// File is the syntax tree of a source file.
+type File struct {
+	Statements []Stmt
+	EOF        Position
+}
+
+func (f *File) Pos() Position {
+	if len(f.Statements) > 0 {
+		return f.Statements[0].Pos()
+	}
+	return f.EOF
+}
+
+func (f *File) End() Position {
+	return f.EOF
+}
@@ -0,0 +1,129 @@
+package ast
+
+// Inspect traverses the tree rooted at node in depth-first order: it calls
+// f(node) and, if it returns true, inspects the children of node, then calls
+// f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	if !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *File:
+		for _, s := range n.Statements {
+			Inspect(s, f)
+		}
+	case *Interpolation:
+		for _, e := range n.Parts {
+			Inspect(e, f)
+		}
+	case *Array:
+		for _, e := range n.Elements {
+			Inspect(e, f)
+		}
+	case *Grouping:
+		Inspect(n.Expr, f)
+	case *Unary:
+		Inspect(n.Operand, f)
+	case *Binary:
+		{
+			Inspect(n.Left, f)
+			Inspect(n.Right, f)
+		}
+	case *Conditional:
+		{
+			Inspect(n.Cond, f)
+			Inspect(n.Then, f)
+			Inspect(n.Else, f)
+		}
+	case *Call:
+		{
+			Inspect(n.Callee, f)
+			for _, e := range n.Args {
+				Inspect(e, f)
+			}
+		}
+	case *Index:
+		{
+			Inspect(n.Object, f)
+			Inspect(n.Index, f)
+		}
+	case *Slice:
+		{
+			Inspect(n.Object, f)
+			if n.Low != nil {
+				Inspect(n.Low, f)
+			}
+			if n.High != nil {
+				Inspect(n.High, f)
+			}
+		}
+	case *Property:
+		{
+			Inspect(n.Object, f)
+			Inspect(n.Name, f)
+		}
+	case *Assign:
+		{
+			Inspect(n.Target, f)
+			if n.Value != nil {
+				Inspect(n.Value, f)
+			}
+		}
+	case *ExprStmt:
+		Inspect(n.Expr, f)
+	case *PrintStmt:
+		Inspect(n.Expr, f)
+	case *AssertStmt:
+		Inspect(n.Expr, f)
+	case *ReturnStmt:
+		Inspect(n.Result, f)
+	case *VarStmt:
+		for _, s := range n.Specs {
+			Inspect(s, f)
+		}
+	case *VarSpec:
+		{
+			Inspect(n.Name, f)
+			if n.Value != nil {
+				Inspect(n.Value, f)
+			}
+		}
+	case *FunStmt:
+		{
+			Inspect(n.Name, f)
+			for _, p := range n.Params {
+				Inspect(p, f)
+			}
+			Inspect(n.Body, f)
+		}
+	case *BlockStmt:
+		for _, s := range n.Statements {
+			Inspect(s, f)
+		}
+	case *IfStmt:
+		{
+			Inspect(n.Cond, f)
+			Inspect(n.Then, f)
+			if n.Else != nil {
+				Inspect(n.Else, f)
+			}
+		}
+	case *WhileStmt:
+		{
+			Inspect(n.Cond, f)
+			Inspect(n.Body, f)
+		}
+	case *ForStmt:
+		{
+			if n.Init != nil {
+				Inspect(n.Init, f)
+			}
+			Inspect(n.Cond, f)
+			Inspect(n.Post, f)
+			Inspect(n.Body, f)
+		}
+	}
+
+	f(nil)
+}
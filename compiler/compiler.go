@@ -2,486 +2,550 @@ package compiler
 
 import (
 	"fmt"
+	"maki/compiler/ast"
 	"maki/vm"
+	"math/big"
+	"sort"
 	"strconv"
+	"strings"
 )
 
+// Compiler generates the code of a function walking the syntax tree returned
+// by the parser.
 type Compiler struct {
 	*vm.Function
-	*parser
 	*scope
+	errors      ErrorList
+	interactive bool // keep the value of the last expression statement
+	optimize    bool
 }
 
-func NewCompiler() *Compiler {
-	return &Compiler{
-		scope: newScope(),
-	}
-}
-
-type precedence uint8
-
-const (
-	PrecNone       precedence = iota
-	PrecAssignment            // =
-	PrecOr                    // or
-	PrecAnd                   // and
-	PrecEquality              // == !=
-	PrecComparison            // < > <= >=
-	PrecTerm                  // + -
-	PrecFactor                // * /
-	PrecUnary                 // not !
-	PrecCall                  // . ()
-	PrecPrimary
-)
+// Option configures a compiler created by NewCompiler.
+type Option func(*Compiler)
 
-type rule struct {
-	prefix func(*Compiler, bool) error
-	infix  func(*Compiler, bool) error
-	precedence
-}
-
-func getRule(tt TokenType) rule {
-	rules := map[TokenType]rule{
-		And:             {prefix: nil, infix: (*Compiler).and, precedence: PrecAnd},
-		Equal:           {prefix: nil, infix: nil, precedence: PrecNone},
-		EqualEqual:      {prefix: nil, infix: (*Compiler).binary, precedence: PrecEquality},
-		False:           {prefix: (*Compiler).literal, infix: nil, precedence: PrecNone},
-		Greater:         {prefix: nil, infix: (*Compiler).binary, precedence: PrecComparison},
-		GreaterEqual:    {prefix: nil, infix: (*Compiler).binary, precedence: PrecComparison},
-		Identifier:      {prefix: (*Compiler).identifier, infix: nil, precedence: PrecNone},
-		LeftParenthesis: {prefix: (*Compiler).grouping, infix: (*Compiler).call, precedence: PrecCall},
-		LeftSquare:      {prefix: (*Compiler).array, infix: nil, precedence: PrecNone},
-		Less:            {prefix: nil, infix: (*Compiler).binary, precedence: PrecComparison},
-		LessEqual:       {prefix: nil, infix: (*Compiler).binary, precedence: PrecComparison},
-		Minus:           {prefix: (*Compiler).unary, infix: (*Compiler).binary, precedence: PrecTerm},
-		Nil:             {prefix: (*Compiler).literal, infix: nil, precedence: PrecNone},
-		Not:             {prefix: (*Compiler).unary, infix: nil, precedence: PrecNone},
-		NotEqual:        {prefix: nil, infix: (*Compiler).binary, precedence: PrecEquality},
-		Number:          {prefix: (*Compiler).number, infix: nil, precedence: PrecNone},
-		Plus:            {prefix: nil, infix: (*Compiler).binary, precedence: PrecTerm},
-		Or:              {prefix: nil, infix: (*Compiler).or, precedence: PrecOr},
-		Slash:           {prefix: nil, infix: (*Compiler).binary, precedence: PrecFactor},
-		Star:            {prefix: nil, infix: (*Compiler).binary, precedence: PrecFactor},
-		String:          {prefix: (*Compiler).string, infix: nil, precedence: PrecNone},
-		True:            {prefix: (*Compiler).literal, infix: nil, precedence: PrecNone},
-	}
-
-	if r, ok := rules[tt]; ok {
-		return r
-	}
-
-	return rule{
-		prefix:     nil,
-		infix:      nil,
-		precedence: PrecNone,
-	}
-}
-
-func (c *Compiler) parsePrecedence(prec precedence) error {
-	last := c.previous
-
-	if err := c.advance(); err != nil {
-		return err
+// Optimize enables constant folding, dead code elimination, jump threading
+// and the dedicated instructions for nil, true and false.
+func Optimize(enabled bool) Option {
+	return func(c *Compiler) {
+		c.optimize = enabled
 	}
+}
 
-	prefix := getRule(c.previous.TokenType).prefix
-
-	if prefix == nil {
-		return fmt.Errorf("compile error, expected expression after '%s' [line %d]", last.Lexeme, c.current.Line)
+func NewCompiler(options ...Option) *Compiler {
+	c := &Compiler{
+		scope: newScope(),
 	}
 
-	assignable := prec <= PrecAssignment
-	if err := prefix(c, assignable); err != nil {
-		return err
+	for _, option := range options {
+		option(c)
 	}
 
-	for prec <= getRule(c.current.TokenType).precedence {
-		if err := c.advance(); err != nil {
-			return err
-		}
-
-		infix := getRule(c.previous.TokenType).infix
+	return c
+}
 
-		if err := infix(c, false); err != nil {
-			return err
-		}
-	}
+// NewInteractiveCompiler returns a compiler for the REPL: when the source ends
+// with an expression statement its value is left on top of the stack, so that
+// it can be displayed.
+func NewInteractiveCompiler(options ...Option) *Compiler {
+	c := NewCompiler(options...)
+	c.interactive = true
+	return c
+}
 
-	if assignable && c.current.TokenType == Equal {
-		return fmt.Errorf("compile error, invalid assignment target [line %d]", c.current.Line)
+// Globals returns the identifiers defined in global scope so far, sorted.
+func (c *Compiler) Globals() []string {
+	gs := make([]string, 0, len(c.scope.globals))
+	for g := range c.scope.globals {
+		gs = append(gs, g)
 	}
-
-	return nil
+	sort.Strings(gs)
+	return gs
 }
 
+// Compile compiles source to the MAIN function. Compiling goes on after an
+// error, so that all of them are returned as ErrorList, but no function is
+// returned and the globals declared by source are forgotten.
 func (c *Compiler) Compile(source string) (*vm.Function, error) {
 	c.Function = vm.NewFunction("MAIN")
-	c.parser = newParser(source)
-
-	if err := c.advance(); err != nil {
-		return nil, err
-	}
-
-	for !c.match(Eof) {
-		if err := c.declaration(false); err != nil {
-			return nil, err
+	c.Source = source
+	c.Symbols = c.scope.symbols
+	saved := c.scope.save()
+
+	p := newParser(source)
+	file := p.file()
+	c.errors = p.errors
+
+	for i, s := range file.Statements {
+		if e, ok := s.(*ast.ExprStmt); ok && c.interactive && i == len(file.Statements)-1 {
+			// last statement, value is kept on the stack
+			if err := c.expression(e.Expr); err != nil {
+				c.errors.add(err)
+			}
+			continue
 		}
+		c.declaration(s)
 	}
 
-	if err := c.consume(Eof); err != nil {
+	if err := c.errors.err(); err != nil {
+		c.scope.restore(saved)
 		return nil, err
 	}
 
-	c.emitByte(vm.OpTerminate)
-
-	return c.Function, nil
-}
-
-func (c *Compiler) and(_ bool) error {
-	jump := c.emitJump(vm.OpJumpIfFalse)
-
-	c.emitByte(vm.OpPop)
-	if err := c.parsePrecedence(PrecAnd); err != nil {
-		return err
-	}
-
-	c.applyPatch(jump)
-	return nil
-}
-
-func (c *Compiler) or(_ bool) error {
-	elseJump := c.emitJump(vm.OpJumpIfFalse)
-	thenJump := c.emitJump(vm.OpJump)
-
-	c.applyPatch(elseJump)
-	c.emitByte(vm.OpPop)
-
-	if err := c.parsePrecedence(PrecOr); err != nil {
-		return err
-	}
-	c.applyPatch(thenJump)
-
-	return nil
-}
-
-func (c *Compiler) binary(_ bool) error {
-	tt := c.previous.TokenType
-	if err := c.parsePrecedence(getRule(tt).precedence); err != nil {
-		return err
-	}
-
-	switch tt {
-	case EqualEqual:
-		c.emitByte(vm.OpEqualEqual)
-	case NotEqual:
-		c.emitByte(vm.OpNotEqual)
-	case Greater:
-		c.emitByte(vm.OpGreater)
-	case GreaterEqual:
-		c.emitByte(vm.OpGreaterEqual)
-	case Less:
-		c.emitByte(vm.OpLess)
-	case LessEqual:
-		c.emitByte(vm.OpLessEqual)
-	case Minus:
-		c.emitByte(vm.OpSubtract)
-	case Plus:
-		c.emitByte(vm.OpAdd)
-	case Star:
-		c.emitByte(vm.OpMultiply)
-	case Slash:
-		c.emitByte(vm.OpDivide)
-	default:
-		return fmt.Errorf("compile error, invalid binary operator '%s' [line %d]", tt, c.previous.Line)
+	c.emitByte(vm.OpTerminate, file.EOF)
+	if c.optimize {
+		thread(c.Code)
 	}
 
-	return nil
+	return c.Function, nil
 }
 
-func (c *Compiler) call(_ bool) error {
-	count, err := c.arguments()
-	if err != nil {
-		return err
-	}
-	c.emitBytes(vm.OpCall, vm.OpCode(count))
-	return nil
-}
+// CompileExpression compiles source as a single expression, whose value is
+// left on top of the stack when the function terminates.
+func (c *Compiler) CompileExpression(source string) (*vm.Function, error) {
+	c.Function = vm.NewFunction("MAIN")
+	c.Source = source
+	c.Symbols = c.scope.symbols
+	saved := c.scope.save()
 
-func (c *Compiler) arguments() (int, error) {
-	var t TokenType
-	switch c.previous.TokenType {
-	case LeftParenthesis:
-		t = RightParenthesis
-	case LeftSquare:
-		t = RightSquare
-	default:
-		return 0, fmt.Errorf("compiler error, unpexcted parenthesis: %s", c.current.Lexeme)
-	}
+	p := newParser(source)
+	e := p.singleExpression()
+	c.errors = p.errors
 
-	count := 0
-	for c.current.TokenType != t {
-		count++
-		if err := c.expression(false); err != nil {
-			return count, err
+	if e != nil {
+		if err := c.expression(e); err != nil {
+			c.errors.add(err)
 		}
-		c.trim(Comma)
-	}
-	if err := c.consume(t); err != nil {
-		return count, err
 	}
-	return count, nil
-}
 
-func (c *Compiler) expression(_ bool) error {
-	if err := c.parsePrecedence(PrecAssignment); err != nil {
-		return err
+	if err := c.errors.err(); err != nil {
+		c.scope.restore(saved)
+		return nil, err
 	}
-	return nil
-}
 
-func (c *Compiler) declaration(_ bool) error {
-	if c.match(Semicolon, NewLine, Eof) {
-		return nil
+	c.emitByte(vm.OpTerminate, p.previous.position())
+	if c.optimize {
+		thread(c.Code)
 	}
 
-	return c.statement()
+	return c.Function, nil
 }
 
-func (c *Compiler) grouping(_ bool) error {
-	if err := c.expression(false); err != nil {
-		return err
+// declaration compiles a statement, on error it is collected so that the
+// following statements are compiled as well.
+func (c *Compiler) declaration(s ast.Stmt) {
+	if err := c.statement(s); err != nil {
+		c.errors.add(err)
 	}
-	return c.consume(RightParenthesis)
 }
 
-func (c *Compiler) literal(_ bool) error {
-	switch c.previous.TokenType {
-	case False:
+func (c *Compiler) statement(s ast.Stmt) error {
+	switch s := s.(type) {
+	case *ast.AssertStmt:
 		{
-			v := vm.Value{ValueType: vm.Bool, Boolean: false}
-			c.emitConstant(v)
+			if err := c.expression(s.Expr); err != nil {
+				return err
+			}
+			c.emitByte(vm.OpAssert, s.End())
 		}
-	case Nil:
+	case *ast.BlockStmt:
+		c.block(s)
+	case *ast.ExprStmt:
 		{
-			v := vm.Value{ValueType: vm.Nil}
-			c.emitConstant(v)
+			if err := c.expression(s.Expr); err != nil {
+				return err
+			}
+			c.emitByte(vm.OpPop, s.End())
+		}
+	case *ast.ForStmt:
+		return c.forStatement(s)
+	case *ast.FunStmt:
+		return c.funStatement(s)
+	case *ast.IfStmt:
+		return c.ifStatement(s)
+	case *ast.PrintStmt:
+		{
+			if err := c.expression(s.Expr); err != nil {
+				return err
+			}
+			c.emitByte(vm.OpPrint, s.End())
 		}
-	case True:
+	case *ast.ReturnStmt:
 		{
-			v := vm.Value{ValueType: vm.Bool, Boolean: true}
-			c.emitConstant(v)
+			if err := c.expression(s.Result); err != nil {
+				return err
+			}
+			c.emitByte(vm.OpReturn, s.End())
 		}
+	case *ast.VarStmt:
+		for _, spec := range s.Specs {
+			if err := c.variable(spec, s.Modifiable); err != nil {
+				return err
+			}
+		}
+	case *ast.WhileStmt:
+		return c.whileStatement(s)
+	default:
+		return fmt.Errorf("unexpected statement %T", s)
 	}
 	return nil
 }
 
-func (c *Compiler) number(_ bool) error {
-	n, err := strconv.ParseFloat(c.previous.Lexeme, 64)
-	if err != nil {
-		return err
-	}
-
-	v := vm.Value{ValueType: vm.Number, Float: n}
-	c.emitConstant(v)
-	return nil
-}
-
-func (c *Compiler) array(_ bool) error {
-	count, err := c.arguments()
-	if err != nil {
-		return err
-	}
-	c.emitBytes(vm.OpArray, vm.OpCode(count))
-	return nil
-}
-
-func (c *Compiler) assert() error {
-	if err := c.expression(false); err != nil {
-		return err
-	}
-	c.emitByte(vm.OpAssert)
-	return nil
-}
-
-func (c *Compiler) print() error {
-	if err := c.expression(false); err != nil {
-		return err
+func (c *Compiler) expression(e ast.Expr) error {
+	if c.optimize {
+		if v, ok := evaluate(e); ok {
+			c.emitValue(v, e.Pos())
+			return nil
+		}
 	}
-	c.emitByte(vm.OpPrint)
-	return nil
-}
 
-func (c *Compiler) statement() error {
-	switch c.current.TokenType {
-	case Assert:
+	switch e := e.(type) {
+	case *ast.Array:
 		{
-			_ = c.advance()
-			if err := c.assert(); err != nil {
-				return err
+			for _, e := range e.Elements {
+				if err := c.expression(e); err != nil {
+					return err
+				}
 			}
+			c.emitBytes(e.Rsquare, vm.OpArray, vm.OpCode(len(e.Elements)))
 		}
-	case For:
+	case *ast.Assign:
 		{
-			_ = c.advance()
-			if err := c.forStatement(); err != nil {
-				return err
+			switch t := e.Target.(type) {
+			case *ast.Ident:
+				return c.identifier(t, e)
+			case *ast.Index:
+				return c.indexing(t, e)
+			default:
+				return errorAt(t.Pos(), "invalid assignment target")
 			}
 		}
-	case Fun:
+	case *ast.Binary:
+		return c.binary(e)
+	case *ast.Conditional:
+		return c.conditional(e)
+	case *ast.Call:
 		{
-			_ = c.advance()
-			if err := c.funStatement(); err != nil {
+			if err := c.expression(e.Callee); err != nil {
 				return err
 			}
-		}
-	case If:
-		{
-			_ = c.advance()
-			if err := c.ifStatement(); err != nil {
-				return err
+			for _, arg := range e.Args {
+				if err := c.expression(arg); err != nil {
+					return err
+				}
 			}
-		}
-
-	case LeftBrace:
+			c.emitBytes(e.Rparen, vm.OpCall, vm.OpCode(len(e.Args)))
+		}
+	case *ast.Grouping:
+		return c.expression(e.Expr)
+	case *ast.Ident:
+		return c.identifier(e, nil)
+	case *ast.Index:
+		return c.indexing(e, nil)
+	case *ast.Interpolation:
+		return c.interpolation(e)
+	case *ast.Literal:
+		return c.literal(e)
+	case *ast.Property:
 		{
-			_ = c.advance()
-			if err := c.block(); err != nil {
+			if err := c.expression(e.Object); err != nil {
 				return err
 			}
+			name := c.Constants.Write(vm.NewString(e.Name.Name))
+			c.emitBytes(e.Name.NamePos, vm.OpGetProperty, vm.OpCode(name))
 		}
-	case Print:
-		{
-			_ = c.advance()
-			if err := c.print(); err != nil {
-				return err
-			}
+	case *ast.Slice:
+		return c.slice(e)
+	case *ast.Unary:
+		return c.unary(e)
+	default:
+		return fmt.Errorf("unexpected expression %T", e)
+	}
+	return nil
+}
+
+// binary operators, the logical ones are compiled to jumps
+var operators = map[string]vm.OpCode{
+	"==": vm.OpEqualEqual,
+	"!=": vm.OpNotEqual,
+	">":  vm.OpGreater,
+	">=": vm.OpGreaterEqual,
+	"<":  vm.OpLess,
+	"<=": vm.OpLessEqual,
+	"in": vm.OpIn,
+	"-":  vm.OpSubtract,
+	"+":  vm.OpAdd,
+	"*":  vm.OpMultiply,
+	"/":  vm.OpDivide,
+	"~/": vm.OpIntegerDivide,
+	"%":  vm.OpModulo,
+	"**": vm.OpPower,
+	"&":  vm.OpBitAnd,
+	"|":  vm.OpBitOr,
+	"^":  vm.OpBitXor,
+	"<<": vm.OpShiftLeft,
+	">>": vm.OpShiftRight,
+}
+
+func (c *Compiler) binary(e *ast.Binary) error {
+	if c.optimize && (e.Op == "and" || e.Op == "or" || e.Op == "??") {
+		// e is not constant, so a constant left operand is the one letting
+		// the right operand be evaluated
+		if _, ok := evaluate(e.Left); ok {
+			return c.expression(e.Right)
 		}
-	case Return:
+	}
+
+	if err := c.expression(e.Left); err != nil {
+		return err
+	}
+
+	switch e.Op {
+	case "and":
 		{
-			_ = c.advance()
-			if err := c.returnStatement(); err != nil {
+			jump := c.emitJump(vm.OpJumpIfFalse, e.OpPos)
+
+			c.emitByte(vm.OpPop, e.OpPos)
+			if err := c.expression(e.Right); err != nil {
 				return err
 			}
+
+			c.applyPatch(jump)
+			return nil
 		}
-	case Var, Let:
+	case "or":
 		{
-			_ = c.advance()
-			if err := c.listVariables(); err != nil {
+			elseJump := c.emitJump(vm.OpJumpIfFalse, e.OpPos)
+			thenJump := c.emitJump(vm.OpJump, e.OpPos)
+
+			c.applyPatch(elseJump)
+			c.emitByte(vm.OpPop, e.OpPos)
+
+			if err := c.expression(e.Right); err != nil {
 				return err
 			}
+			c.applyPatch(thenJump)
+			return nil
 		}
-	case While:
+	case "??":
 		{
-			_ = c.advance()
-			if err := c.whileStatement(); err != nil {
+			// the left operand is kept unless it is nil
+			c.emitByte(vm.OpDuplicate, e.OpPos)
+			c.emitValue(vm.Value{ValueType: vm.Nil}, e.OpPos)
+			c.emitByte(vm.OpNotEqual, e.OpPos)
+			elseJump := c.emitJump(vm.OpJumpIfFalse, e.OpPos)
+			c.emitByte(vm.OpPop, e.OpPos)
+			thenJump := c.emitJump(vm.OpJump, e.OpPos)
+
+			c.applyPatch(elseJump)
+			c.emitBytes(e.OpPos, vm.OpPop, vm.OpPop)
+
+			if err := c.expression(e.Right); err != nil {
 				return err
 			}
+			c.applyPatch(thenJump)
+			return nil
 		}
-	default:
-		{
-			if err := c.expression(false); err != nil {
-				return err
-			}
+	}
 
-			if c.current.TokenType != RightBrace {
-				if err := c.consume(Semicolon, NewLine, Eof); err != nil {
-					return err
-				}
-			}
+	op, ok := operators[e.Op]
+	if !ok {
+		return errorAt(e.OpPos, "invalid binary operator '%s'", e.Op)
+	}
 
-			c.emitByte(vm.OpPop)
-			return nil
-		}
+	if err := c.expression(e.Right); err != nil {
+		return err
 	}
 
-	c.trim(Semicolon, NewLine)
+	// runtime errors point to the operator
+	c.emitByte(op, e.OpPos)
 	return nil
 }
 
-// block statements parser
-func (c *Compiler) block() error {
-	c.scope.begin()
-
-	for !c.check(RightBrace) && !c.check(Eof) {
-		if err := c.declaration(false); err != nil {
-			return err
+func (c *Compiler) conditional(e *ast.Conditional) (err error) {
+	if c.optimize {
+		if v, ok := evaluate(e.Cond); ok {
+			// a single branch is ever taken
+			taken, discarded := e.Then, e.Else
+			if !v.BoolValue() {
+				taken, discarded = e.Else, e.Then
+			}
+			c.discard(func() { err = c.expression(discarded) })
+			if err != nil {
+				return err
+			}
+			return c.expression(taken)
 		}
 	}
-	if err := c.consume(RightBrace); err != nil {
+
+	if err := c.expression(e.Cond); err != nil {
+		return err
+	}
+
+	thenJump := c.emitJump(vm.OpJumpIfFalse, e.Question)
+	c.emitByte(vm.OpPop, e.Question) // pop condition in then branch
+	if err := c.expression(e.Then); err != nil {
 		return err
 	}
 
-	c.scope.end(func() { c.emitByte(vm.OpPop) })
+	elseJump := c.emitJump(vm.OpJump, e.Colon)
+	c.applyPatch(thenJump)
+	c.emitByte(vm.OpPop, e.Colon) // pop condition in else branch
+	if err := c.expression(e.Else); err != nil {
+		return err
+	}
+	c.applyPatch(elseJump)
 
 	return nil
 }
 
-func (c *Compiler) string(_ bool) error {
-	v := vm.Value{ValueType: vm.Object, Ptr: c.previous.Lexeme}
-	c.emitConstant(v)
+// interpolation concatenates the parts of the string, leaving out the empty
+// literals.
+func (c *Compiler) interpolation(e *ast.Interpolation) error {
+	count := 0
+	for _, part := range e.Parts {
+		if l, ok := part.(*ast.Literal); ok && l.Value == "" {
+			continue
+		}
+		if count == 255 {
+			return errorAt(part.Pos(), "too many parts in interpolated string")
+		}
+		if err := c.expression(part); err != nil {
+			return err
+		}
+		count++
+	}
+	c.emitBytes(e.End(), vm.OpConcat, vm.OpCode(count))
 	return nil
 }
 
-func (c *Compiler) unary(_ bool) error {
-	tt := c.previous.TokenType
-
-	if err := c.parsePrecedence(PrecUnary); err != nil {
+func (c *Compiler) literal(e *ast.Literal) error {
+	v, err := value(e)
+	if err != nil {
 		return err
 	}
 
-	switch tt {
-	case Not:
-		c.emitByte(vm.OpNot)
-	case Minus:
-		c.emitByte(vm.OpMinus)
-	}
+	c.emitValue(v, e.ValuePos)
 	return nil
 }
 
-// variable declarations parser
-func (c *Compiler) listVariables() error {
-	modifiable := c.previous.TokenType == Var
-
-	// multiple declarations
-	if c.match(LeftBrace) {
-		c.trim(NewLine)
-		for c.current.TokenType != RightBrace {
-			if err := c.variable(false, modifiable); err != nil {
-				return err
+// value returns the value of a literal.
+func value(e *ast.Literal) (vm.Value, error) {
+	var v vm.Value
+	switch e.Kind {
+	case ast.False:
+		v = vm.Value{ValueType: vm.Bool, Boolean: false}
+	case ast.Nil:
+		v = vm.Value{ValueType: vm.Nil}
+	case ast.True:
+		v = vm.Value{ValueType: vm.Bool, Boolean: true}
+	case ast.Number:
+		return number(e)
+	case ast.String:
+		v = vm.NewString(e.Value)
+	}
+	return v, nil
+}
+
+// number returns the value of a number literal: literals with suffix n are
+// big integers, with suffix d decimals, without a decimal point integers, big
+// if they do not fit in int64, and floats otherwise.
+func number(e *ast.Literal) (vm.Value, error) {
+	switch literal := e.Value[:len(e.Value)-1]; e.Value[len(e.Value)-1] {
+	case 'n':
+		{
+			n, ok := new(big.Int).SetString(literal, 10)
+			if !ok {
+				return vm.Value{}, errorAt(e.ValuePos, "invalid big integer '%s'", e.Value)
 			}
-			c.trim(NewLine)
+			return vm.NewBigInt(n), nil
+		}
+	case 'd':
+		{
+			r, ok := new(big.Rat).SetString(literal)
+			if !ok {
+				return vm.Value{}, errorAt(e.ValuePos, "invalid decimal '%s'", e.Value)
+			}
+			return vm.NewDecimal(r), nil
+		}
+	}
+
+	if !strings.Contains(e.Value, ".") {
+		if n, err := strconv.ParseInt(e.Value, 10, 64); err == nil {
+			return vm.Value{ValueType: vm.Integer, Int: n}, nil
+		}
+		if n, ok := new(big.Int).SetString(e.Value, 10); ok {
+			return vm.NewBigInt(n), nil
+		}
+	}
+
+	n, err := strconv.ParseFloat(e.Value, 64)
+	if err != nil {
+		return vm.Value{}, errorAt(e.ValuePos, "invalid number '%s'", e.Value)
+	}
+	return vm.Value{ValueType: vm.Number, Float: n}, nil
+}
+
+// block statements compiler
+func (c *Compiler) block(b *ast.BlockStmt) {
+	c.scope.begin()
+
+	returned := false
+	for _, s := range b.Statements {
+		if returned && c.optimize {
+			c.discard(func() { c.declaration(s) })
+			continue
+		}
+		c.declaration(s)
+
+		if _, ok := s.(*ast.ReturnStmt); ok {
+			returned = true
 		}
-		return c.consume(RightBrace)
 	}
 
-	// single declaration
-	return c.variable(false, modifiable)
+	c.scope.end(func() { c.emitByte(vm.OpPop, b.Rbrace) })
 }
 
-func (c *Compiler) variable(isArgument bool, modifiable bool) error {
-	identifier := c.current
+func (c *Compiler) unary(e *ast.Unary) error {
+	if c.optimize && e.Op == "!" {
+		if operand, ok := e.Operand.(*ast.Unary); ok && operand.Op == "!" && isBoolean(operand.Operand) {
+			return c.expression(operand.Operand)
+		}
+	}
 
-	if err := c.consume(Identifier); err != nil {
+	if err := c.expression(e.Operand); err != nil {
 		return err
 	}
 
+	switch e.Op {
+	case "!":
+		c.emitByte(vm.OpNot, e.OpPos)
+	case "-":
+		c.emitByte(vm.OpMinus, e.OpPos)
+	case "~":
+		c.emitByte(vm.OpBitNot, e.OpPos)
+	default:
+		return errorAt(e.OpPos, "invalid unary operator '%s'", e.Op)
+	}
+	return nil
+}
+
+func (c *Compiler) variable(spec *ast.VarSpec, modifiable bool) error {
+	identifier := spec.Name
+
 	// declare variable
 	if c.scope.depth > 0 {
-		if err := c.addLocal(*identifier, modifiable); err != nil {
+		if err := c.addLocal(identifier, modifiable); err != nil {
 			return err
 		}
 	}
 
 	// define variable
-	if c.match(Equal) {
-		if err := c.expression(false); err != nil {
+	if spec.Value != nil {
+		if err := c.expression(spec.Value); err != nil {
 			return err
 		}
 	} else {
-		if !isArgument {
-			v := vm.Value{ValueType: vm.Nil}
-			c.emitConstant(v)
-		}
+		c.emitValue(vm.Value{ValueType: vm.Nil}, identifier.NamePos)
 	}
 
 	if c.scope.depth > 0 {
@@ -490,133 +554,224 @@ func (c *Compiler) variable(isArgument bool, modifiable bool) error {
 	}
 
 	// define variable as global
-	if _, ok := c.scope.globals[identifier.Lexeme]; ok {
-		return fmt.Errorf("compile error, variable '%s' is already defined in global scope [line %d]", identifier.Lexeme, identifier.Line)
+	if _, ok := c.scope.globals[identifier.Name]; ok {
+		return errorAt(identifier.NamePos, "variable '%s' is already defined in global scope", identifier.Name)
 	}
 
-	c.emitByte(vm.OpDefineGlobal)
-	c.WriteIdentifier(identifier.Lexeme, identifier.Line)
-	c.scope.addGlobal(identifier.Lexeme, modifiable)
+	slot, err := c.slot(identifier)
+	if err != nil {
+		return err
+	}
+	c.emitBytes(spec.End(), vm.OpDefineGlobal, vm.OpCode(slot))
+	c.scope.addGlobal(identifier.Name, modifiable)
 
 	return nil
 }
 
-func (c *Compiler) indexing() error {
-	if c.match(Number) {
-		n, err := strconv.ParseInt(c.previous.Lexeme, 10, 64)
-		if err != nil {
-			return err
+// indexing compiles the access to an element, reading it if assign is nil.
+// Compound assignments evaluate the object and the index once, increments and
+// decrements leave the value the element had before.
+func (c *Compiler) indexing(e *ast.Index, assign *ast.Assign) error {
+	if l, ok := e.Index.(*ast.Literal); ok && l.Kind == ast.Number {
+		if _, err := strconv.ParseInt(l.Value, 10, 64); err != nil {
+			return errorAt(l.ValuePos, "invalid index '%s'", l.Value)
 		}
-		if n < 0 {
-			return fmt.Errorf("compile error, index cannot be negative: %d", n)
-		}
-		if err := c.consume(RightSquare); err != nil {
-			return err
+	}
+	if id := root(e); assign != nil && id != nil {
+		if _, _, modifiable := c.resolveVar(id.Name); !modifiable {
+			return errorAt(id.NamePos, "cannot assign expression to constant '%s'", id.Name)
 		}
-		v := vm.Value{ValueType: vm.Number, Float: float64(n)}
-		c.emitConstant(v)
-		return nil
 	}
-	if err := c.expression(false); err != nil {
+
+	if err := c.expression(e.Object); err != nil {
 		return err
 	}
-	return c.consume(RightSquare)
-}
-
-// identifier parser
-func (c *Compiler) identifier(assignable bool) error {
-	identifier := c.previous.Lexeme
-	isLocal, addr, modifiable := c.resolveVar(identifier)
-	isIndexed := c.match(LeftSquare)
+	if err := c.expression(e.Index); err != nil {
+		return err
+	}
+	if assign == nil {
+		c.emitByte(vm.OpIndexGet, e.Lsquare)
+		return nil
+	}
 
-	var getOp, setOp vm.OpCode
-	if isLocal {
-		if isIndexed {
-			getOp = vm.OpGetLocalIndex
-			setOp = vm.OpSetLocalIndex
-		} else {
-			getOp = vm.OpGetLocal
-			setOp = vm.OpSetLocal
+	if assign.Op == "=" {
+		if err := c.expression(assign.Value); err != nil {
+			return err
 		}
 	} else {
-		if isIndexed {
-			getOp = vm.OpGetGlobalIndex
-			setOp = vm.OpSetGlobalIndex
-		} else {
-			getOp = vm.OpGetGlobal
-			setOp = vm.OpSetGlobal
+		// the object and the index are left on the stack for the assignment
+		c.emitByte(vm.OpDuplicatePair, e.Lsquare)
+		c.emitByte(vm.OpIndexGet, e.Lsquare)
+		if isPostfix(assign) {
+			// the old value is kept under the object and the index
+			c.emitByte(vm.OpRotate, e.Lsquare)
+			c.emitByte(vm.OpDuplicatePair, e.Lsquare)
+			c.emitByte(vm.OpIndexGet, e.Lsquare)
+		}
+		if err := c.update(assign); err != nil {
+			return err
 		}
 	}
 
-	if isIndexed {
-		if err := c.indexing(); err != nil {
-			return err
+	c.emitByte(vm.OpIndexSet, e.Lsquare)
+	if isPostfix(assign) {
+		c.emitByte(vm.OpPop, e.Lsquare)
+	}
+	return nil
+}
+
+// root returns the variable holding the array e is an element of, e.g. m for
+// m[i][j], or nil if the array is not held by a variable.
+func root(e *ast.Index) *ast.Ident {
+	object := e.Object
+	for {
+		switch o := object.(type) {
+		case *ast.Grouping:
+			object = o.Expr
+		case *ast.Ident:
+			return o
+		case *ast.Index:
+			object = o.Object
+		default:
+			return nil
 		}
 	}
-	if c.match(Equal) && assignable {
-		if !modifiable {
-			return fmt.Errorf("compile error, cannot assign expression to constant '%s' [line %d]", identifier, c.current.Line)
+}
+
+// slice compiles the value to slice and its bounds, nil when missing.
+func (c *Compiler) slice(e *ast.Slice) error {
+	if err := c.expression(e.Object); err != nil {
+		return err
+	}
+	for _, bound := range []ast.Expr{e.Low, e.High} {
+		if bound == nil {
+			c.emitValue(vm.Value{ValueType: vm.Nil}, e.Colon)
+		} else if err := c.expression(bound); err != nil {
+			return err
 		}
+	}
+	c.emitByte(vm.OpSlice, e.Lsquare)
+	return nil
+}
+
+// compound maps the compound assignment operators to the operation applied to
+// the variable.
+var compound = map[string]vm.OpCode{
+	"+=": vm.OpAdd,
+	"-=": vm.OpSubtract,
+	"*=": vm.OpMultiply,
+	"/=": vm.OpDivide,
+	"++": vm.OpAdd,
+	"--": vm.OpSubtract,
+}
+
+// identifier compiles the access to a variable, that is read if assign is
+// nil, otherwise it is assigned. Compound assignments read the variable,
+// apply the operation and write it back, increments and decrements leave the
+// value the variable had before.
+func (c *Compiler) identifier(id *ast.Ident, assign *ast.Assign) error {
+	isLocal, addr, modifiable := c.resolveVar(id.Name)
 
-		// assignment
-		if err := c.expression(false); err != nil {
+	if !isLocal {
+		slot, err := c.slot(id)
+		if err != nil {
 			return err
 		}
+		addr = slot
+	}
 
-		c.emitBytes(setOp)
-	} else {
+	getOp, setOp := vm.OpGetGlobal, vm.OpSetGlobal
+	if isLocal {
+		getOp, setOp = vm.OpGetLocal, vm.OpSetLocal
+	}
+
+	if assign == nil {
 		// reading identifier
-		c.emitBytes(getOp)
+		c.emitBytes(id.NamePos, getOp, vm.OpCode(addr))
+		return nil
 	}
-	if isLocal {
-		c.Write(vm.OpCode(addr), c.current.Line)
+
+	if !modifiable {
+		return errorAt(id.NamePos, "cannot assign expression to constant '%s'", id.Name)
+	}
+
+	if assign.Op == "=" {
+		if err := c.expression(assign.Value); err != nil {
+			return err
+		}
 	} else {
-		c.WriteIdentifier(identifier, c.current.Line)
+		c.emitBytes(id.NamePos, getOp, vm.OpCode(addr))
+		if isPostfix(assign) {
+			c.emitByte(vm.OpDuplicate, id.NamePos)
+		}
+		if err := c.update(assign); err != nil {
+			return err
+		}
 	}
 
+	c.emitBytes(id.NamePos, setOp, vm.OpCode(addr))
+	if isPostfix(assign) {
+		c.emitByte(vm.OpPop, id.NamePos)
+	}
 	return nil
 }
 
-func (c *Compiler) funStatement() error {
-	fun := c.Function
-	t := c.current
-
-	c.Function = vm.NewFunction(t.Lexeme)
-	c.begin()
+// isPostfix tells whether assign is an increment or a decrement, which have
+// no value and evaluate to the variable before the update.
+func isPostfix(assign *ast.Assign) bool {
+	return assign.Op == "++" || assign.Op == "--"
+}
 
-	if err := c.consume(Identifier); err != nil {
-		return err
+// update compiles the operation of a compound assignment, applied to the
+// current value that is on the stack.
+func (c *Compiler) update(assign *ast.Assign) error {
+	op, ok := compound[assign.Op]
+	if !ok {
+		return errorAt(assign.OpPos, "invalid assignment operator '%s'", assign.Op)
 	}
 
-	if err := c.consume(LeftParenthesis); err != nil {
+	if assign.Value == nil {
+		c.emitValue(vm.Value{ValueType: vm.Integer, Int: 1}, assign.OpPos)
+	} else if err := c.expression(assign.Value); err != nil {
 		return err
 	}
+	// runtime errors point to the operator
+	c.emitByte(op, assign.OpPos)
+	return nil
+}
 
-	for c.current.TokenType != RightParenthesis {
-		c.Arity++
-		c.trim(Var)
+func (c *Compiler) funStatement(s *ast.FunStmt) (err error) {
+	fun := c.Function
 
-		if err := c.variable(true, true); err != nil {
-			return err
-		}
+	c.Function = vm.NewFunction(s.Name.Name)
+	c.Source = fun.Source
+	c.Symbols = fun.Symbols
+	c.Arity = len(s.Params)
+	c.begin()
 
-		c.trim(Comma)
-	}
+	defer func() {
+		if err != nil {
+			// restore enclosing function and scope, so that compiling can go on
+			c.end(func() {})
+			c.Function = fun
+		}
+	}()
 
-	if err := c.consume(RightParenthesis); err != nil {
-		return err
+	for _, param := range s.Params {
+		if err := c.addLocal(param, true); err != nil {
+			return err
+		}
 	}
 
-	if err := c.consume(LeftBrace); err != nil {
-		return err
-	}
+	end := s.Body.Rbrace
 
-	if err := c.block(); err != nil {
-		return err
+	c.block(s.Body)
+	c.end(func() { c.emitByte(vm.OpPop, end) })
+	c.emitValue(vm.Value{ValueType: vm.Nil}, end)
+	c.emitByte(vm.OpReturn, end)
+	if c.optimize {
+		thread(c.Code)
 	}
-	c.end(func() { c.emitByte(vm.OpPop) })
-	c.WriteConstant(vm.Value{ValueType: vm.Nil}, c.current.Line)
-	c.emitByte(vm.OpReturn)
 
 	v := vm.Value{
 		ValueType: vm.Object,
@@ -625,134 +780,143 @@ func (c *Compiler) funStatement() error {
 
 	c.Function = fun
 
-	c.emitConstant(v)
-	c.emitByte(vm.OpDefineGlobal)
-	c.WriteIdentifier(t.Lexeme, t.Line)
-	c.scope.addGlobal(t.Lexeme, false)
-
-	return nil
-}
-
-func (c *Compiler) returnStatement() error {
-	if err := c.expression(false); err != nil {
+	slot, err := c.slot(s.Name)
+	if err != nil {
 		return err
 	}
+	c.emitConstant(v, end)
+	c.emitBytes(end, vm.OpDefineGlobal, vm.OpCode(slot))
+	c.scope.addGlobal(s.Name.Name, false)
 
-	c.emitByte(vm.OpReturn)
 	return nil
 }
 
-func (c *Compiler) ifStatement() error {
+func (c *Compiler) ifStatement(s *ast.IfStmt) error {
+	if c.optimize {
+		if v, ok := evaluate(s.Cond); ok {
+			// a single branch is ever taken
+			if v.BoolValue() {
+				c.block(s.Then)
+				if s.Else != nil {
+					c.discard(func() { c.block(s.Else) })
+				}
+			} else {
+				c.discard(func() { c.block(s.Then) })
+				if s.Else != nil {
+					c.block(s.Else)
+				}
+			}
+			return nil
+		}
+	}
+
 	// condition
-	if err := c.expression(false); err != nil {
+	if err := c.expression(s.Cond); err != nil {
 		return err
 	}
 
-	thenJump := c.emitJump(vm.OpJumpIfFalse)
-	c.emitByte(vm.OpPop) // pop condition in then branch
+	thenJump := c.emitJump(vm.OpJumpIfFalse, s.Cond.End())
+	c.emitByte(vm.OpPop, s.Cond.End()) // pop condition in then branch
 
 	// then
-	if err := c.consume(LeftBrace); err != nil {
-		return err
-	}
-	if err := c.block(); err != nil {
-		return err
-	}
+	c.block(s.Then)
 
-	elseJump := c.emitJump(vm.OpJump)
+	elseJump := c.emitJump(vm.OpJump, s.Then.Rbrace)
 	c.applyPatch(thenJump)
-	c.emitByte(vm.OpPop) // pop condition in else branch
+	c.emitByte(vm.OpPop, s.Then.Rbrace) // pop condition in else branch
 
-	if c.match(Else) {
-		if err := c.consume(LeftBrace); err != nil {
-			return err
-		}
-		if err := c.block(); err != nil {
-			return err
-		}
+	if s.Else != nil {
+		c.block(s.Else)
 	}
 	c.applyPatch(elseJump)
 
 	return nil
 }
 
-func (c *Compiler) whileStatement() error {
+func (c *Compiler) whileStatement(s *ast.WhileStmt) error {
 	// condition
 	loopStart := c.getCurrentAddress()
-	if err := c.expression(false); err != nil {
+	if err := c.expression(s.Cond); err != nil {
 		return err
 	}
-	exitJump := c.emitJump(vm.OpJumpIfFalse)
+	exitJump := c.emitJump(vm.OpJumpIfFalse, s.Cond.End())
 
 	// body
-	c.emitByte(vm.OpPop)
-	if err := c.statement(); err != nil {
+	c.emitByte(vm.OpPop, s.Cond.End())
+	if err := c.statement(s.Body); err != nil {
 		return err
 	}
-	c.emitLoop(loopStart)
+	c.emitLoop(loopStart, s.Body.End())
 	c.applyPatch(exitJump)
+	c.emitByte(vm.OpPop, s.Body.End()) // pop condition value
 
 	return nil
 }
 
-func (c *Compiler) forStatement() error {
+func (c *Compiler) forStatement(s *ast.ForStmt) error {
 	c.scope.begin()
+	defer c.scope.end(func() { c.emitByte(vm.OpPop, s.Body.End()) })
 
 	// initializer
-	if err := c.declaration(false); err != nil {
-		return err
+	if s.Init != nil {
+		c.declaration(s.Init)
 	}
 
 	// condition
 	conditionLoop := c.getCurrentAddress()
-	if err := c.expression(false); err != nil {
+	if err := c.expression(s.Cond); err != nil {
 		return err
 	}
-	if err := c.consume(Semicolon); err != nil {
-		return err
-	}
-	exitJump := c.emitJump(vm.OpJumpIfFalse)
-	c.emitByte(vm.OpPop) // pop condition value
-	bodyJump := c.emitJump(vm.OpJump)
+	exitJump := c.emitJump(vm.OpJumpIfFalse, s.Cond.End())
+	c.emitByte(vm.OpPop, s.Cond.End()) // pop condition value
+	bodyJump := c.emitJump(vm.OpJump, s.Cond.End())
 
 	// increment
 	incrementLoop := c.getCurrentAddress()
-	if err := c.expression(false); err != nil {
+	if err := c.expression(s.Post); err != nil {
 		return err
 	}
-	c.emitByte(vm.OpPop)
-	c.emitLoop(conditionLoop)
+	c.emitByte(vm.OpPop, s.Post.End())
+	c.emitLoop(conditionLoop, s.Post.End())
 
 	// body
 	c.applyPatch(bodyJump)
-	if err := c.statement(); err != nil {
+	if err := c.statement(s.Body); err != nil {
 		return err
 	}
-	c.emitLoop(incrementLoop)
+	c.emitLoop(incrementLoop, s.Body.End())
 
 	c.applyPatch(exitJump)
-	c.emitByte(vm.OpPop) // pop condition value
-	c.scope.end(func() { c.emitByte(vm.OpPop) })
+	c.emitByte(vm.OpPop, s.Body.End()) // pop condition value
 
 	return nil
 }
 
+// span returns the span of source code at position p.
+func span(p ast.Position) vm.Span {
+	return vm.Span{
+		Line:   p.Line,
+		Column: p.Column,
+		Length: p.Length,
+	}
+}
+
 func (c Compiler) getCurrentAddress() int {
 	return len(c.Code)
 }
 
-func (c *Compiler) emitByte(byte vm.OpCode) {
-	c.Write(byte, c.previous.Line)
+func (c *Compiler) emitByte(byte vm.OpCode, p ast.Position) {
+	c.Write(byte, span(p))
 }
 
-func (c *Compiler) emitBytes(bytes ...vm.OpCode) {
+func (c *Compiler) emitBytes(p ast.Position, bytes ...vm.OpCode) {
 	for _, b := range bytes {
-		c.emitByte(b)
+		c.emitByte(b, p)
 	}
 }
 
-func (c *Compiler) emitJump(op vm.OpCode) int {
-	c.emitBytes(op, vm.OpCode(0))
+func (c *Compiler) emitJump(op vm.OpCode, p ast.Position) int {
+	c.emitBytes(p, op, vm.OpCode(0))
 	return c.getCurrentAddress() - 1
 }
 
@@ -761,12 +925,29 @@ func (c *Compiler) applyPatch(patch int) {
 	c.Code[patch] = vm.OpCode(offset)
 }
 
-func (c *Compiler) emitLoop(startLoop int) {
-	c.emitByte(vm.OpLoop)
+func (c *Compiler) emitLoop(startLoop int, p ast.Position) {
+	c.emitByte(vm.OpLoop, p)
 	offset := c.getCurrentAddress() - startLoop - 1
-	c.emitByte(vm.OpCode(offset))
+	c.emitByte(vm.OpCode(offset), p)
 }
 
-func (c *Compiler) emitConstant(v vm.Value) {
-	c.WriteConstant(v, c.current.Line)
+func (c *Compiler) emitConstant(v vm.Value, p ast.Position) {
+	c.WriteConstant(v, span(p))
+}
+
+// emitValue emits a constant, or the instruction pushing it if there is a
+// dedicated one and the compiler optimizes.
+func (c *Compiler) emitValue(v vm.Value, p ast.Position) {
+	switch {
+	case !c.optimize:
+		c.emitConstant(v, p)
+	case v.ValueType == vm.Nil:
+		c.emitByte(vm.OpNil, p)
+	case v.ValueType == vm.Bool && v.Boolean:
+		c.emitByte(vm.OpTrue, p)
+	case v.ValueType == vm.Bool:
+		c.emitByte(vm.OpFalse, p)
+	default:
+		c.emitConstant(v, p)
+	}
 }
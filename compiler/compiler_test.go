@@ -0,0 +1,267 @@
+package compiler
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestCompiler_Errors(t *testing.T) {
+	tcs := []struct {
+		name   string
+		in     string
+		errors []Error
+	}{
+		{
+			name: "Happy Path",
+			in:   "var x = 1\nprint x + 2\n",
+		},
+		{
+			name: "Single Error",
+			in:   "print (1 + 2\n",
+			errors: []Error{
+				{Line: 1, Column: 13, Length: 1, Message: "expected ')'"},
+			},
+		},
+		{
+			name: "Starts With Parenthesis",
+			in:   ")\nprint 1\n",
+			errors: []Error{
+				{Line: 1, Column: 1, Length: 1, Message: "unexpected ')'"},
+			},
+		},
+		{
+			name: "Starts With Brace",
+			in:   "}\n",
+			errors: []Error{
+				{Line: 1, Column: 1, Length: 1, Message: "unexpected '}'"},
+			},
+		},
+		{
+			name: "Line Starts With Parenthesis",
+			in:   "print 1\n)\n",
+			errors: []Error{
+				{Line: 2, Column: 1, Length: 1, Message: "expected expression after new line"},
+			},
+		},
+		{
+			name: "Starts With Operator",
+			in:   "* 2\nprint +\n",
+			errors: []Error{
+				{Line: 1, Column: 1, Length: 1, Message: "unexpected '*'"},
+				{Line: 2, Column: 7, Length: 1, Message: "expected expression after 'print'"},
+			},
+		},
+		{
+			name: "Errors On Many Lines",
+			in:   "print 1 +\nvar x = 1\nlet y = \nx = * 2\nprint x\n",
+			errors: []Error{
+				{Line: 1, Column: 10, Length: 1, Message: "expected expression after '+'"},
+				{Line: 3, Column: 9, Length: 1, Message: "expected expression after '='"},
+				{Line: 4, Column: 5, Length: 1, Message: "expected expression after '='"},
+			},
+		},
+		{
+			name: "Errors Separated By Semicolon",
+			in:   "print ); print 1; print (",
+			errors: []Error{
+				{Line: 1, Column: 7, Length: 1, Message: "expected expression after 'print'"},
+				{Line: 1, Column: 26, Length: 0, Message: "expected expression after '('"},
+			},
+		},
+		{
+			name: "Errors Inside Blocks",
+			in:   "{\n    var x = )\n    print x\n    let y = (\n}\nprint 42 +\n",
+			errors: []Error{
+				{Line: 2, Column: 13, Length: 1, Message: "expected expression after '='"},
+				{Line: 4, Column: 14, Length: 1, Message: "expected expression after '('"},
+				{Line: 6, Column: 11, Length: 1, Message: "expected expression after '+'"},
+			},
+		},
+		{
+			name: "Errors Inside Functions",
+			in:   "fun f(a) {\n    return a +\n}\nfun g( {\n    print 1\n}\nf(1) g()\n",
+			errors: []Error{
+				{Line: 2, Column: 15, Length: 1, Message: "expected expression after '+'"},
+				{Line: 4, Column: 8, Length: 1, Message: "expected identifier"},
+				{Line: 7, Column: 6, Length: 1, Message: "expected ';' or new line or end of file"},
+			},
+		},
+		{
+			name: "Skip Unbalanced Block",
+			in:   "if 1 == {\n    print 1\n}\nprint )\n",
+			errors: []Error{
+				{Line: 1, Column: 9, Length: 1, Message: "expected expression after '=='"},
+				{Line: 4, Column: 7, Length: 1, Message: "expected expression after 'print'"},
+			},
+		},
+		{
+			name: "Scanner Errors",
+			in:   "print @\nprint 1 $ 2\nprint \"unterminated",
+			errors: []Error{
+				{Line: 1, Column: 7, Length: 1, Message: "unknown character '@'"},
+				{Line: 2, Column: 9, Length: 1, Message: "unknown character '$'"},
+				{Line: 3, Column: 7, Length: 13, Message: "unterminated string"},
+			},
+		},
+		{
+			name: "Scope Errors",
+			in:   "let x = 1\nx = 2\n{\n    var y\n    var y\n}\nvar x\n",
+			errors: []Error{
+				{Line: 2, Column: 1, Length: 1, Message: "cannot assign expression to constant 'x'"},
+				{Line: 5, Column: 9, Length: 1, Message: "variable 'y' is already defined in this scope"},
+				{Line: 7, Column: 5, Length: 1, Message: "variable 'x' is already defined in global scope"},
+			},
+		},
+		{
+			name: "Compound Assignment Errors",
+			in:   "let n = 1\nn += 2\nn++\nprint 1 + n += 1\nprint (n)++ + 1\n",
+			errors: []Error{
+				{Line: 2, Column: 1, Length: 1, Message: "cannot assign expression to constant 'n'"},
+				{Line: 3, Column: 1, Length: 1, Message: "cannot assign expression to constant 'n'"},
+				{Line: 4, Column: 13, Length: 2, Message: "invalid assignment target"},
+				{Line: 5, Column: 10, Length: 2, Message: "invalid assignment target"},
+			},
+		},
+		{
+			name: "Prefix Increment",
+			in:   "var n = 1\n++n\nprint --n\n",
+			errors: []Error{
+				{Line: 2, Column: 1, Length: 2, Message: "prefix '++' is not supported, use '+= 1'"},
+				{Line: 3, Column: 7, Length: 2, Message: "prefix '--' is not supported, use '-= 1'"},
+			},
+		},
+		{
+			name: "Index Assignment Errors",
+			in:   "let m = [[1]]\nm[0][0] = 2\n(m)[0] += 3\nf()[0] = 4\nf() = 5\n",
+			errors: []Error{
+				{Line: 2, Column: 1, Length: 1, Message: "cannot assign expression to constant 'm'"},
+				{Line: 3, Column: 2, Length: 1, Message: "cannot assign expression to constant 'm'"},
+				{Line: 5, Column: 5, Length: 1, Message: "invalid assignment target"},
+			},
+		},
+		{
+			name: "Interpolation Errors",
+			in:   "print \"${}\"\nprint \"${1 2}\"\nprint \"${x\n",
+			errors: []Error{
+				{Line: 1, Column: 10, Length: 2, Message: "expected expression after '${'"},
+				{Line: 2, Column: 12, Length: 1, Message: "expected '}' after interpolated expression"},
+				{Line: 3, Column: 11, Length: 1, Message: "expected '}' after interpolated expression"},
+				{Line: 4, Column: 1, Length: 0, Message: "unterminated string"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			fun, err := NewCompiler().Compile(tc.in)
+
+			if len(tc.errors) == 0 {
+				if err != nil {
+					t.Fatalf("got %v, want nil", err.Error())
+				}
+				return
+			}
+
+			if fun != nil {
+				t.Errorf("got function, want nil")
+			}
+
+			errs, ok := err.(ErrorList)
+			if !ok {
+				t.Fatalf("got %T, want ErrorList", err)
+			}
+
+			if len(errs) != len(tc.errors) {
+				t.Fatalf("got %d errors, want %d: %v", len(errs), len(tc.errors), err)
+			}
+
+			for i := range errs {
+				if *errs[i] != tc.errors[i] {
+					t.Errorf("got %+v, want %+v", *errs[i], tc.errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCompiler_GlobalLimit(t *testing.T) {
+	var source strings.Builder
+	for i := 0; i < size; i++ {
+		fmt.Fprintf(&source, "var g%d = %d\n", i, i)
+	}
+
+	c := NewInteractiveCompiler()
+	if _, err := c.Compile(source.String()); err != nil {
+		t.Fatalf("got %v, want nil", err.Error())
+	}
+
+	want := "too many global variables, at most 256 names can be used as globals"
+	for _, in := range []string{"print g256", "var g256 = 0"} {
+		if _, err := c.Compile(in); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got %v, want %q", err, want)
+		}
+	}
+	if c.Symbols.Len() != size {
+		t.Errorf("got %d slots, want %d", c.Symbols.Len(), size)
+	}
+
+	// names that have a slot can still be used
+	if _, err := c.Compile("g0 = g255"); err != nil {
+		t.Errorf("got %v, want nil", err.Error())
+	}
+}
+
+// lines matches the line column of the disassembly, left out when comparing
+// since it is debug information.
+var lines = regexp.MustCompile(`(?m)^(\d{4}) +(\d+|\|) `)
+
+func TestCompiler_Golden(t *testing.T) {
+	files, err := filepath.Glob("../test/*/*.maki")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(file), "../test/"), ".maki")
+
+		t.Run(name, func(t *testing.T) {
+			source, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fun, err := NewCompiler().Compile(string(source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := lines.ReplaceAllString(fun.String(), "$1 ")
+
+			golden := filepath.Join("testdata", name+".pcode")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != string(want) {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package compiler
+
+import (
+	"fmt"
+	"maki/compiler/ast"
+	"maki/vm"
+	"sort"
+	"strings"
+)
+
+// Error is a compile error found at a position of the source.
+type Error struct {
+	Line    int
+	Column  int
+	Length  int
+	Message string
+}
+
+func newError(t *Token, format string, args ...interface{}) *Error {
+	return errorAt(t.position(), format, args...)
+}
+
+func errorAt(p ast.Position, format string, args ...interface{}) *Error {
+	return &Error{
+		Line:    p.Line,
+		Column:  p.Column,
+		Length:  p.Length,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Span returns where the error is in source.
+func (e *Error) Span() vm.Span {
+	return vm.Span{
+		Line:   e.Line,
+		Column: e.Column,
+		Length: e.Length,
+	}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("compile error, %s [line %d:%d]", e.Message, e.Line, e.Column)
+}
+
+// ErrorList collects all the errors found compiling a source.
+type ErrorList []*Error
+
+func (l *ErrorList) add(err error) {
+	if e, ok := err.(*Error); ok {
+		*l = append(*l, e)
+		return
+	}
+	*l = append(*l, &Error{Message: err.Error()})
+}
+
+// sort orders errors by their position in the source.
+func (l ErrorList) sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Line != l[j].Line {
+			return l[i].Line < l[j].Line
+		}
+		return l[i].Column < l[j].Column
+	})
+}
+
+// err returns the list as error, or nil if it is empty.
+func (l ErrorList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	l.sort()
+	return l
+}
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, e := range l {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "\n")
+}
@@ -0,0 +1,366 @@
+package compiler
+
+import (
+	"strings"
+)
+
+const indent = "    "
+
+// class of an operator, that depends on the tokens around it
+type class uint8
+
+const (
+	operand class = iota // not an operator
+	unary
+	binary
+	unknown // neither unary nor binary, source spacing is kept
+	bounds  // colon between slice bounds, never spaced
+)
+
+// line of formatted source
+type line struct {
+	tokens []*Token
+	spec   bool // inside a var or let block
+}
+
+// formatter lays out the tokens of source, comments included.
+type formatter struct {
+	source []rune
+	lines  []*line
+}
+
+// Format returns source in canonical form: lines are indented by four spaces
+// for each open brace, binary operators are surrounded by spaces, var and let
+// blocks have a declaration per line with aligned values, blank lines are
+// collapsed and trailing semicolons are dropped. Comments are kept.
+//
+// Formatting works on tokens, so source needs to be scanned without errors
+// but it may not be parsed.
+func Format(source string) (string, error) {
+	s := newScanner(source)
+	s.comments = true
+
+	tokens, err := s.Scan()
+	if err != nil {
+		return "", err
+	}
+
+	f := &formatter{source: s.source}
+	f.split(tokens)
+	return f.String(), nil
+}
+
+// split groups tokens into lines, breaking the lines of var and let blocks
+// after the opening brace and before the closing one.
+func (f *formatter) split(tokens []Token) {
+	var blocks []bool // for each open brace, whether it is a var block
+	current := &line{}
+
+	newLine := func() {
+		current.tokens = trimSemicolons(current.tokens)
+		f.lines = append(f.lines, current)
+		current = &line{spec: len(blocks) > 0 && blocks[len(blocks)-1]}
+	}
+
+	for i := range tokens {
+		t := &tokens[i]
+
+		switch t.TokenType {
+		case NewLine:
+			newLine()
+		case Eof:
+			{
+				if len(current.tokens) > 0 {
+					newLine()
+				}
+				return
+			}
+		case LeftBrace:
+			{
+				isVar := false
+				if n := len(current.tokens); n > 0 {
+					tt := current.tokens[n-1].TokenType
+					isVar = tt == Var || tt == Let
+				}
+				current.tokens = append(current.tokens, t)
+				blocks = append(blocks, isVar)
+
+				if next := tokens[i+1].TokenType; isVar && next != NewLine && next != Comment && next != RightBrace {
+					newLine()
+				}
+			}
+		case RightBrace:
+			{
+				isVar := false
+				if n := len(blocks); n > 0 {
+					isVar = blocks[n-1]
+					blocks = blocks[:n-1]
+				}
+
+				if n := len(current.tokens); isVar && n > 0 && current.tokens[n-1].TokenType != LeftBrace {
+					newLine()
+				}
+				current.spec = false
+				current.tokens = append(trimSemicolons(current.tokens), t)
+			}
+		default:
+			current.tokens = append(current.tokens, t)
+		}
+	}
+}
+
+// trimSemicolons drops the semicolons at the end of tokens, that are not
+// needed before a new line or a closing brace.
+func trimSemicolons(tokens []*Token) []*Token {
+	n := len(tokens)
+	if n > 0 && tokens[n-1].TokenType == Comment {
+		n--
+	}
+	for n > 0 && tokens[n-1].TokenType == Semicolon {
+		tokens = append(tokens[:n-1], tokens[n:]...)
+		n--
+	}
+	return tokens
+}
+
+func (f *formatter) String() string {
+	var out []string
+	var specs []int // lines of the var block being aligned
+
+	// align the values of consecutive declarations
+	align := func() {
+		width := 0
+		for _, i := range specs {
+			if n := len(strings.SplitN(out[i], " = ", 2)[0]); n > width {
+				width = n
+			}
+		}
+		for _, i := range specs {
+			parts := strings.SplitN(out[i], " = ", 2)
+			out[i] = parts[0] + strings.Repeat(" ", width-len(parts[0])) + " = " + parts[1]
+		}
+		specs = specs[:0]
+	}
+
+	depth := 0
+	blank := false
+	last := ""
+
+	for _, l := range f.lines {
+		if len(l.tokens) == 0 {
+			blank = true
+			align()
+			continue
+		}
+
+		// closing tokens at the beginning of the line are outdented
+		level := depth
+		for _, t := range l.tokens {
+			if !isClosing(t.TokenType) {
+				break
+			}
+			level--
+		}
+		for _, t := range l.tokens {
+			if isOpening(t.TokenType) {
+				depth++
+			} else if isClosing(t.TokenType) && depth > 0 {
+				depth--
+			}
+		}
+		if level < 0 {
+			level = 0
+		}
+
+		// keep a blank line, but not at the beginning or at the end of a block
+		if blank && len(out) > 0 && !strings.HasSuffix(last, "{") && !isClosing(l.tokens[0].TokenType) {
+			out = append(out, "")
+		}
+		blank = false
+
+		text := strings.Repeat(indent, level) + f.format(l.tokens)
+		last = text
+
+		if l.spec && l.tokens[0].TokenType == Identifier && strings.HasPrefix(f.format(l.tokens[1:]), "= ") {
+			specs = append(specs, len(out))
+		} else {
+			align()
+		}
+		out = append(out, text)
+	}
+	align()
+
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// format lays out the tokens of a line.
+func (f *formatter) format(tokens []*Token) string {
+	classes := classify(tokens)
+
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && f.space(tokens[i-1], t, classes[i-1], classes[i]) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.text(t))
+	}
+	return b.String()
+}
+
+// text returns the token as written in source.
+func (f *formatter) text(t *Token) string {
+	text := string(f.source[t.Offset : t.Offset+t.Length])
+	if t.TokenType == Comment {
+		text = strings.TrimRight(text, " \t\r")
+	}
+	return text
+}
+
+// space reports whether a space goes between a and b.
+func (f *formatter) space(a, b *Token, ca, cb class) bool {
+	switch {
+	case a.TokenType == Comment || b.TokenType == Comment:
+		return true
+	case ca == bounds || cb == bounds:
+		return false
+	case ca == unknown || cb == unknown:
+		return a.Offset+a.Length < b.Offset
+	case a.TokenType == Interpolation:
+		return false
+	case (b.TokenType == String || b.TokenType == Interpolation) && f.source[b.Offset] == '}':
+		// the rest of an interpolated string
+		return false
+	case a.TokenType == LeftParenthesis || a.TokenType == LeftSquare || a.TokenType == Dot:
+		return false
+	case b.TokenType == RightParenthesis || b.TokenType == RightSquare:
+		return false
+	case b.TokenType == Comma || b.TokenType == Semicolon || b.TokenType == Dot:
+		return false
+	case b.TokenType == PlusPlus || b.TokenType == MinusMinus:
+		return false
+	case a.TokenType == Minus && b.TokenType == Minus:
+		// kept apart, they would read as '--'
+		return true
+	case ca == unary:
+		return false
+	case b.TokenType == LeftParenthesis || b.TokenType == LeftSquare:
+		// calls and indexing
+		return !isOperandEnd(a.TokenType)
+	case a.TokenType == LeftBrace && b.TokenType == RightBrace:
+		return false
+	}
+	return true
+}
+
+// classify tells unary and binary operators apart, looking at the tokens
+// around them.
+func classify(tokens []*Token) []class {
+	classes := make([]class, len(tokens))
+
+	// for each open square, the question marks waiting for their colon
+	var questions []int
+
+	var prev *Token
+	for i, t := range tokens {
+		if t.TokenType == Comment {
+			continue
+		}
+
+		var next *Token
+		for _, n := range tokens[i+1:] {
+			if n.TokenType != Comment {
+				next = n
+				break
+			}
+		}
+
+		afterOperand := prev != nil && isOperandEnd(prev.TokenType)
+		beforeOperand := next != nil && isOperandStart(next.TokenType)
+
+		switch t.TokenType {
+		case LeftSquare:
+			questions = append(questions, 0)
+		case RightSquare:
+			if n := len(questions); n > 0 {
+				questions = questions[:n-1]
+			}
+		case Question:
+			if n := len(questions); n > 0 {
+				questions[n-1]++
+			}
+		}
+
+		switch t.TokenType {
+		case Not, Tilde:
+			classes[i] = unary
+		case Colon:
+			{
+				n := len(questions)
+				if n > 0 && questions[n-1] == 0 {
+					classes[i] = bounds
+					break
+				}
+				if n > 0 {
+					questions[n-1]--
+				}
+				if afterOperand && beforeOperand {
+					classes[i] = binary
+				} else {
+					classes[i] = unknown
+				}
+			}
+		case Minus:
+			{
+				if !afterOperand {
+					classes[i] = unary
+				} else if beforeOperand {
+					classes[i] = binary
+				} else {
+					classes[i] = unknown
+				}
+			}
+		case Ampersand, Caret, Equal, EqualEqual, NotEqual, Greater, GreaterEqual, GreaterGreater, Less,
+			LessEqual, LessLess, MinusEqual, Percent, Pipe, Plus, PlusEqual, Question, QuestionQuestion, Slash,
+			SlashEqual, Star, StarEqual, StarStar:
+			{
+				if afterOperand && beforeOperand {
+					classes[i] = binary
+				} else {
+					classes[i] = unknown
+				}
+			}
+		}
+
+		prev = t
+	}
+
+	return classes
+}
+
+func isOpening(tt TokenType) bool {
+	return tt == LeftBrace || tt == LeftParenthesis || tt == LeftSquare
+}
+
+func isClosing(tt TokenType) bool {
+	return tt == RightBrace || tt == RightParenthesis || tt == RightSquare
+}
+
+func isOperandEnd(tt TokenType) bool {
+	switch tt {
+	case Identifier, Number, String, True, False, Nil, This, Super, RightParenthesis, RightSquare, PlusPlus, MinusMinus:
+		return true
+	}
+	return false
+}
+
+func isOperandStart(tt TokenType) bool {
+	switch tt {
+	case Identifier, Interpolation, Number, String, True, False, Nil, This, Super, LeftParenthesis, LeftSquare, Minus, Not,
+		Tilde:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tcs := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "Indentation",
+			in:   "fun f(n) {\nif n {\n\t\treturn 1\n  } else {\nreturn 2\n}\n}",
+			want: "fun f(n) {\n    if n {\n        return 1\n    } else {\n        return 2\n    }\n}\n",
+		},
+		{
+			name: "Operators",
+			in:   "print -a+b*( c-1 )==!d and e<=-f",
+			want: "print -a + b * (c - 1) == !d and e <= -f\n",
+		},
+		{
+			name: "Bitwise Operators",
+			in:   "print a&~b|c^d<<1>>e%2**-f",
+			want: "print a & ~b | c ^ d << 1 >> e % 2 ** -f\n",
+		},
+		{
+			name: "Compound Assignment",
+			in:   "i+=1\nxs[ i ] ++\nn--\nprint - -n",
+			want: "i += 1\nxs[i]++\nn--\nprint - -n\n",
+		},
+		{
+			name: "Conditional Operators",
+			in:   "print a?-b:c??d",
+			want: "print a ? -b : c ?? d\n",
+		},
+		{
+			name: "Interpolation",
+			in:   "print \"${ a+1 }, ${f( b )}\" + \"${ {} }\"",
+			want: "print \"${a + 1}, ${f(b)}\" + \"${{}}\"\n",
+		},
+		{
+			name: "Slices And Methods",
+			in:   "print s[ 1 : n ]+s[ : 2 ] . upper( )+s[i :]\nprint s[a ? 1 : 2 : 3]",
+			want: "print s[1:n] + s[:2].upper() + s[i:]\nprint s[a ? 1 : 2:3]\n",
+		},
+		{
+			name: "Calls And Indexing",
+			in:   "f (a ,b) [ 0 ]\nprint [ 1, -2 ][i]\nxs [i] = g()",
+			want: "f(a, b)[0]\nprint [1, -2][i]\nxs[i] = g()\n",
+		},
+		{
+			name: "Variable Blocks",
+			in:   "var { a = 1 }\nlet {\n    pi=3.14\n    x\n    e = 2.71\n    answer = 42\n}\nvar {}",
+			want: "var {\n    a = 1\n}\nlet {\n    pi = 3.14\n    x\n    e      = 2.71\n    answer = 42\n}\nvar {}\n",
+		},
+		{
+			name: "Comments",
+			in:   "/*\n * header\n */\nprint 1   // one\n{\n// inside\n  print /* two */ 2\n}",
+			want: "/*\n * header\n */\nprint 1 // one\n{\n    // inside\n    print /* two */ 2\n}\n",
+		},
+		{
+			name: "Blank Lines",
+			in:   "\n\nprint 1\n\n\n\nprint 2\n{\n\n    print 3\n\n}\n\n",
+			want: "print 1\n\nprint 2\n{\n    print 3\n}\n",
+		},
+		{
+			name: "Semicolons",
+			in:   "print 1; print 2;\nfor var i = 0;i < 3;i = i + 1 { print i; }",
+			want: "print 1; print 2\nfor var i = 0; i < 3; i = i + 1 { print i }\n",
+		},
+		{
+			name: "Unknown Syntax",
+			in:   "for var i = 0; i < n; i++ {\n    io.println(xs.length)\n}",
+			want: "for var i = 0; i < n; i++ {\n    io.println(xs.length)\n}\n",
+		},
+		{
+			name: "Empty",
+			in:   "\n\n",
+			want: "",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Format(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormat_Error(t *testing.T) {
+	if _, err := Format("print \"unterminated"); err == nil {
+		t.Errorf("got nil, want error")
+	}
+}
+
+// TestFormat_Corpus checks that formatting is idempotent and does not change
+// the compiled code.
+func TestFormat_Corpus(t *testing.T) {
+	tests, err := filepath.Glob("../test/*/*.maki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples, err := filepath.Glob("../example/*.maki")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range append(tests, examples...) {
+		t.Run(file, func(t *testing.T) {
+			source, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			formatted, err := Format(string(source))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			again, err := Format(formatted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != formatted {
+				t.Errorf("got\n%s\nwant\n%s", again, formatted)
+			}
+
+			want, err := NewCompiler().Compile(string(source))
+			if err != nil {
+				// not valid Maki, e.g. the syntax example
+				return
+			}
+			got, err := NewCompiler().Compile(formatted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g, w := lines.ReplaceAllString(got.String(), "$1 "), lines.ReplaceAllString(want.String(), "$1 "); g != w {
+				t.Errorf("got\n%s\nwant\n%s", g, w)
+			}
+		})
+	}
+}
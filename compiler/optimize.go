@@ -0,0 +1,203 @@
+package compiler
+
+import (
+	"maki/compiler/ast"
+	"maki/vm"
+)
+
+// Optimizations enabled by the Optimize option. Constant expressions are
+// folded and unreachable code is dropped while generating code, leaving the
+// syntax tree untouched, then jumps are threaded on the code of each function.
+
+// evaluate returns the value of e if it can be computed at compile time, that
+// is when it is made of literals only and the VM would not raise an error.
+func evaluate(e ast.Expr) (vm.Value, bool) {
+	switch e := e.(type) {
+	case *ast.Binary:
+		return evaluateBinary(e)
+	case *ast.Conditional:
+		{
+			cond, ok := evaluate(e.Cond)
+			if !ok {
+				return cond, false
+			}
+			if cond.BoolValue() {
+				return evaluate(e.Then)
+			}
+			return evaluate(e.Else)
+		}
+	case *ast.Grouping:
+		return evaluate(e.Expr)
+	case *ast.Interpolation:
+		{
+			values := make([]vm.Value, len(e.Parts))
+			for i, part := range e.Parts {
+				v, ok := evaluate(part)
+				if !ok {
+					return v, false
+				}
+				values[i] = v
+			}
+			return vm.Concat(values), true
+		}
+	case *ast.Literal:
+		{
+			v, err := value(e)
+			return v, err == nil
+		}
+	case *ast.Unary:
+		{
+			v, ok := evaluate(e.Operand)
+			if !ok {
+				return v, false
+			}
+
+			switch e.Op {
+			case "!":
+				return vm.Value{ValueType: vm.Bool, Boolean: !v.BoolValue()}, true
+			case "-":
+				{
+					v, err := vm.Negate(v)
+					return v, err == nil
+				}
+			case "~":
+				{
+					v, err := vm.Complement(v)
+					return v, err == nil
+				}
+			}
+		}
+	}
+	return vm.Value{}, false
+}
+
+func evaluateBinary(e *ast.Binary) (vm.Value, bool) {
+	lhs, ok := evaluate(e.Left)
+	if !ok {
+		return lhs, false
+	}
+
+	// logical operators evaluate to one of the operands, like their jumps do
+	switch e.Op {
+	case "and":
+		if !lhs.BoolValue() {
+			return lhs, true
+		}
+		return evaluate(e.Right)
+	case "or":
+		if lhs.BoolValue() {
+			return lhs, true
+		}
+		return evaluate(e.Right)
+	case "??":
+		if lhs.ValueType != vm.Nil {
+			return lhs, true
+		}
+		return evaluate(e.Right)
+	}
+
+	rhs, ok := evaluate(e.Right)
+	if !ok {
+		return rhs, false
+	}
+
+	// the operators the VM applies, so that folding gives the same result
+	op := operators[e.Op]
+	switch op {
+	case vm.OpEqualEqual, vm.OpNotEqual:
+		{
+			equal, err := vm.Equal(lhs, rhs)
+			return vm.Value{ValueType: vm.Bool, Boolean: equal == (op == vm.OpEqualEqual)}, err == nil
+		}
+	case vm.OpGreater, vm.OpGreaterEqual, vm.OpLess, vm.OpLessEqual:
+		{
+			v, err := vm.Compare(op, lhs, rhs)
+			return v, err == nil
+		}
+	case vm.OpIn:
+		{
+			v, err := vm.Contains(rhs, lhs)
+			return v, err == nil
+		}
+	case vm.OpAdd, vm.OpSubtract, vm.OpMultiply, vm.OpDivide, vm.OpIntegerDivide, vm.OpModulo, vm.OpPower:
+		{
+			v, err := vm.Arithmetic(op, lhs, rhs)
+			return v, err == nil
+		}
+	case vm.OpBitAnd, vm.OpBitOr, vm.OpBitXor, vm.OpShiftLeft, vm.OpShiftRight:
+		{
+			v, err := vm.Bitwise(op, lhs, rhs)
+			return v, err == nil
+		}
+	}
+	return vm.Value{}, false
+}
+
+// isBoolean tells whether e always evaluates to true or false, so that a
+// double negation of e can be dropped.
+func isBoolean(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.Binary:
+		switch e.Op {
+		case "==", "!=", ">", ">=", "<", "<=", "in":
+			return true
+		}
+	case *ast.Conditional:
+		return isBoolean(e.Then) && isBoolean(e.Else)
+	case *ast.Grouping:
+		return isBoolean(e.Expr)
+	case *ast.Literal:
+		return e.Kind == ast.True || e.Kind == ast.False
+	case *ast.Unary:
+		return e.Op == "!"
+	}
+	return false
+}
+
+// discard compiles unreachable code with f, so that its errors are still
+// reported, and throws the code away.
+func (c *Compiler) discard(f func()) {
+	fun := c.Function
+	c.Function = vm.NewFunction(fun.Name)
+	c.Source = fun.Source
+	c.Symbols = fun.Symbols
+	f()
+	c.Function = fun
+}
+
+// thread retargets the jumps landing on another jump to its destination, a
+// jump landing on a loop instruction loops itself.
+func thread(code []vm.OpCode) {
+	for i := 0; i < len(code); i += 1 + code[i].Operands() {
+		op := code[i]
+		if op != vm.OpJump && op != vm.OpJumpIfFalse {
+			continue
+		}
+
+		// the address of the offset is i + 1, the jump lands on i + offset
+		target := i + int(code[i+1])
+		for n := 0; n < len(code) && target+1 < len(code); n++ {
+			next := code[target]
+			// the value tested by a conditional jump is left on the stack,
+			// a second test of it jumps too
+			if next != vm.OpJump && (op != vm.OpJumpIfFalse || next != vm.OpJumpIfFalse) {
+				break
+			}
+			destination := target + int(code[target+1])
+			if destination-i > 255 {
+				break
+			}
+			target = destination
+		}
+		code[i+1] = vm.OpCode(target - i)
+
+		if op == vm.OpJump && target+1 < len(code) && code[target] == vm.OpLoop {
+			// loops land on t - offset, where t is the address of OP_LOOP
+			destination := target - int(code[target+1])
+			if destination <= i && i-destination <= 255 {
+				code[i] = vm.OpLoop
+				code[i+1] = vm.OpCode(i - destination)
+			}
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"maki/vm"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tcs := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "Constant Folding",
+			in:   "print 1 + 2 * 3\nprint \"a\" + \"b\"\nprint 1 + \"a\"",
+			want: `__MAIN__
+0000 OP_VALUE '7'
+0002 OP_PRINT
+0003 OP_VALUE 'ab'
+0005 OP_PRINT
+0006 OP_VALUE '1'
+0008 OP_VALUE 'a'
+0010 OP_ADD
+0011 OP_PRINT
+0012 OP_TERMINATE
+`,
+		},
+		{
+			name: "Conditional Expressions",
+			in:   "var x\nprint 1 < 2 ? x : 3\nprint nil ?? x\nprint false ?? x\nprint x ? 1 : 1 > 2 ? 3 : 4",
+			want: `__MAIN__
+0000 OP_NIL
+0001 OP_DEFINE_GLOBAL 'x'
+0003 OP_GET_GLOBAL 'x'
+0005 OP_PRINT
+0006 OP_GET_GLOBAL 'x'
+0008 OP_PRINT
+0009 OP_FALSE
+0010 OP_PRINT
+0011 OP_GET_GLOBAL 'x'
+0013 OP_JUMP_IF_FALSE 7 -> 20
+0015 OP_POP
+0016 OP_VALUE '1'
+0018 OP_JUMP 5 -> 23
+0020 OP_POP
+0021 OP_VALUE '4'
+0023 OP_PRINT
+0024 OP_TERMINATE
+`,
+		},
+		{
+			name: "Dedicated Instructions",
+			in:   "var x\nprint true\nprint !(1 < 2)\nprint !!(x == nil)",
+			want: `__MAIN__
+0000 OP_NIL
+0001 OP_DEFINE_GLOBAL 'x'
+0003 OP_TRUE
+0004 OP_PRINT
+0005 OP_FALSE
+0006 OP_PRINT
+0007 OP_GET_GLOBAL 'x'
+0009 OP_NIL
+0010 OP_EQUAL_EQUAL
+0011 OP_PRINT
+0012 OP_TERMINATE
+`,
+		},
+		{
+			name: "Logical Operators",
+			in:   "var x = true\nprint true and x\nprint false or x\nprint false and x",
+			want: `__MAIN__
+0000 OP_TRUE
+0001 OP_DEFINE_GLOBAL 'x'
+0003 OP_GET_GLOBAL 'x'
+0005 OP_PRINT
+0006 OP_GET_GLOBAL 'x'
+0008 OP_PRINT
+0009 OP_FALSE
+0010 OP_PRINT
+0011 OP_TERMINATE
+`,
+		},
+		{
+			name: "Constant Condition",
+			in:   "if false {\n    print 1\n} else {\n    print 2\n}\nif 1 < 2 {\n    print 3\n}",
+			want: `__MAIN__
+0000 OP_VALUE '2'
+0002 OP_PRINT
+0003 OP_VALUE '3'
+0005 OP_PRINT
+0006 OP_TERMINATE
+`,
+		},
+		{
+			name: "Code After Return",
+			in:   "fun f() {\n    return 1\n    print 2\n}",
+			want: `__MAIN__
+0000 OP_VALUE 'f' __fun__
+0002 OP_DEFINE_GLOBAL 'f'
+0004 OP_TERMINATE
+
+__f__
+0000 OP_VALUE '1'
+0002 OP_RETURN
+0003 OP_NIL
+0004 OP_RETURN
+`,
+		},
+		{
+			name: "Jump To Jump",
+			in:   "var a = true\nvar b = true\nif a and b {\n    print 1\n}",
+			want: `__MAIN__
+0000 OP_TRUE
+0001 OP_DEFINE_GLOBAL 'a'
+0003 OP_TRUE
+0004 OP_DEFINE_GLOBAL 'b'
+0006 OP_GET_GLOBAL 'a'
+0008 OP_JUMP_IF_FALSE 13 -> 21
+0010 OP_POP
+0011 OP_GET_GLOBAL 'b'
+0013 OP_JUMP_IF_FALSE 8 -> 21
+0015 OP_POP
+0016 OP_VALUE '1'
+0018 OP_PRINT
+0019 OP_JUMP 3 -> 22
+0021 OP_POP
+0022 OP_TERMINATE
+`,
+		},
+		{
+			name: "Jump To Loop",
+			in:   "var i = 0\nwhile i < 3 {\n    if i == 1 {\n        print i\n    } else {\n        i = i + 1\n    }\n}",
+			want: `__MAIN__
+0000 OP_VALUE '0'
+0002 OP_DEFINE_GLOBAL 'i'
+0004 OP_GET_GLOBAL 'i'
+0006 OP_VALUE '3'
+0008 OP_LESS
+0009 OP_JUMP_IF_FALSE 27 -> 36
+0011 OP_POP
+0012 OP_GET_GLOBAL 'i'
+0014 OP_VALUE '1'
+0016 OP_EQUAL_EQUAL
+0017 OP_JUMP_IF_FALSE 8 -> 25
+0019 OP_POP
+0020 OP_GET_GLOBAL 'i'
+0022 OP_PRINT
+0023 OP_LOOP 19 -> 4
+0025 OP_POP
+0026 OP_GET_GLOBAL 'i'
+0028 OP_VALUE '1'
+0030 OP_ADD
+0031 OP_SET_GLOBAL 'i'
+0033 OP_POP
+0034 OP_LOOP 30 -> 4
+0036 OP_POP
+0037 OP_TERMINATE
+`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			fun, err := NewCompiler(Optimize(true)).Compile(tc.in)
+			if err != nil {
+				t.Fatalf("got %v, want nil", err.Error())
+			}
+
+			if got := lines.ReplaceAllString(fun.String(), "$1 "); got != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOptimize_UnreachableErrors(t *testing.T) {
+	in := "let x = 1\nif false {\n    x = 2\n}\nfun f() {\n    return 1\n    x = 3\n}\n"
+	_, err := NewCompiler(Optimize(true)).Compile(in)
+
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got %T, want ErrorList", err)
+	}
+	if len(errs) != 2 || errs[0].Line != 3 || errs[1].Line != 7 {
+		t.Errorf("got %v, want errors at lines 3 and 7", err)
+	}
+}
+
+func BenchmarkOptimize(b *testing.B) {
+	fib, err := ioutil.ReadFile("../example/fib.maki")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	programs := []struct {
+		name   string
+		source string
+	}{
+		{name: "Fib", source: string(fib)},
+		{
+			name:   "Constants",
+			source: "var sum = 0\nfor var i = 0; i < 10000; i = i + 1 {\n    if i < 60 * 60 * 24 and !!true {\n        sum = sum + 2 * 3.5\n    }\n}\n",
+		},
+	}
+
+	for _, p := range programs {
+		for _, optimize := range []bool{false, true} {
+			name := p.name
+			if optimize {
+				name += "-O"
+			}
+
+			b.Run(name, func(b *testing.B) {
+				fun, err := NewCompiler(Optimize(optimize)).Compile(p.source)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := vm.NewVM(vm.Stdout(ioutil.Discard)).Run(fun); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package compiler
 
 import (
-	"fmt"
+	"maki/compiler/ast"
 	"strings"
 )
 
@@ -9,6 +9,8 @@ type parser struct {
 	*scanner
 	current  *Token
 	previous *Token
+	errors   ErrorList
+	failed   int // last line with a scanner error
 }
 
 func newParser(source string) *parser {
@@ -19,15 +21,40 @@ func newParser(source string) *parser {
 	}
 }
 
-func (p *parser) advance() error {
+// Parse returns the syntax tree of source. Parsing goes on after an error,
+// so that all of them are returned as ErrorList along with the statements
+// parsed successfully.
+func Parse(source string) (*ast.File, error) {
+	p := newParser(source)
+	file := p.file()
+	return file, p.errors.err()
+}
+
+// advance moves to the next token, collecting scanner errors so that parsing
+// can go on.
+func (p *parser) advance() {
 	p.previous = p.current
 
-	var err error
-	if p.current, err = p.scanToken(); err != nil {
-		return err
+	for {
+		t, err := p.scanToken()
+		if err == nil {
+			p.current = t
+			return
+		}
+		p.errors.add(err)
+		if e, ok := err.(*Error); ok {
+			p.failed = e.Line
+		}
 	}
+}
 
-	return nil
+// report collects err, unless it is on the same line of a scanner error since
+// it is likely a consequence of it.
+func (p *parser) report(err error) {
+	if e, ok := err.(*Error); ok && e.Line == p.failed {
+		return
+	}
+	p.errors.add(err)
 }
 
 func (p *parser) check(tt TokenType) bool {
@@ -37,7 +64,7 @@ func (p *parser) check(tt TokenType) bool {
 func (p *parser) match(tts ...TokenType) bool {
 	for _, tt := range tts {
 		if p.current.TokenType == tt {
-			_ = p.advance()
+			p.advance()
 			return true
 		}
 	}
@@ -55,7 +82,7 @@ func (p *parser) trim(tts ...TokenType) {
 func (p *parser) consume(tts ...TokenType) error {
 	for _, tt := range tts {
 		if p.current.TokenType == tt {
-			_ = p.advance()
+			p.advance()
 			return nil
 		}
 	}
@@ -63,11 +90,759 @@ func (p *parser) consume(tts ...TokenType) error {
 	beautify := func(tts ...TokenType) string {
 		var l []string
 		for _, tt := range tts {
-			l = append(l, string(tt))
+			l = append(l, tt.Name())
 		}
 
 		return strings.Join(l, " or ")
 	}
 
-	return fmt.Errorf("compile error, expected '%s' [line %d]", beautify(tts...), p.current.Line)
+	return newError(p.current, "expected %s", beautify(tts...))
+}
+
+// synchronize skips tokens until a statement boundary, that is a new line or
+// a semicolon, or the closing brace of the enclosing block, so that parsing
+// can go on after an error. Blocks opened in the meantime are skipped as a whole.
+func (p *parser) synchronize() {
+	depth := 0
+	if p.previous != nil {
+		switch p.previous.TokenType {
+		case NewLine, Semicolon:
+			return
+		case LeftBrace:
+			depth++
+		}
+	}
+
+	for !p.check(Eof) {
+		switch p.current.TokenType {
+		case NewLine, Semicolon:
+			{
+				if depth == 0 {
+					p.advance()
+					return
+				}
+			}
+		case LeftBrace:
+			depth++
+		case RightBrace:
+			{
+				if depth == 0 {
+					return
+				}
+				depth--
+			}
+		}
+		p.advance()
+	}
+}
+
+type precedence uint8
+
+const (
+	PrecNone        precedence = iota
+	PrecAssignment             // =
+	PrecConditional            // ?:
+	PrecCoalesce               // ??
+	PrecOr                     // or
+	PrecAnd                    // and
+	PrecEquality               // == !=
+	PrecComparison             // < > <= >=
+	PrecBitOr                  // |
+	PrecBitXor                 // ^
+	PrecBitAnd                 // &
+	PrecShift                  // << >>
+	PrecTerm                   // + -
+	PrecFactor                 // * / %
+	PrecUnary                  // ! - ~
+	PrecExponent               // **
+	PrecCall                   // . () [] ++ --
+	PrecPrimary
+)
+
+type rule struct {
+	prefix func(*parser, bool) (ast.Expr, error)
+	infix  func(*parser, ast.Expr) (ast.Expr, error)
+	precedence
+}
+
+func getRule(tt TokenType) rule {
+	rules := map[TokenType]rule{
+		Ampersand:        {prefix: nil, infix: (*parser).binary, precedence: PrecBitAnd},
+		And:              {prefix: nil, infix: (*parser).and, precedence: PrecAnd},
+		Caret:            {prefix: nil, infix: (*parser).binary, precedence: PrecBitXor},
+		Equal:            {prefix: nil, infix: nil, precedence: PrecNone},
+		Dot:              {prefix: nil, infix: (*parser).property, precedence: PrecCall},
+		EqualEqual:       {prefix: nil, infix: (*parser).binary, precedence: PrecEquality},
+		False:            {prefix: (*parser).literal, infix: nil, precedence: PrecNone},
+		Greater:          {prefix: nil, infix: (*parser).binary, precedence: PrecComparison},
+		GreaterEqual:     {prefix: nil, infix: (*parser).binary, precedence: PrecComparison},
+		GreaterGreater:   {prefix: nil, infix: (*parser).binary, precedence: PrecShift},
+		Identifier:       {prefix: (*parser).identifier, infix: nil, precedence: PrecNone},
+		In:               {prefix: nil, infix: (*parser).binary, precedence: PrecComparison},
+		Interpolation:    {prefix: (*parser).interpolation, infix: nil, precedence: PrecNone},
+		LeftParenthesis:  {prefix: (*parser).grouping, infix: (*parser).call, precedence: PrecCall},
+		LeftSquare:       {prefix: (*parser).array, infix: (*parser).index, precedence: PrecCall},
+		Less:             {prefix: nil, infix: (*parser).binary, precedence: PrecComparison},
+		LessEqual:        {prefix: nil, infix: (*parser).binary, precedence: PrecComparison},
+		LessLess:         {prefix: nil, infix: (*parser).binary, precedence: PrecShift},
+		Minus:            {prefix: (*parser).unary, infix: (*parser).binary, precedence: PrecTerm},
+		MinusMinus:       {prefix: nil, infix: (*parser).postfix, precedence: PrecCall},
+		Nil:              {prefix: (*parser).literal, infix: nil, precedence: PrecNone},
+		Not:              {prefix: (*parser).unary, infix: nil, precedence: PrecNone},
+		NotEqual:         {prefix: nil, infix: (*parser).binary, precedence: PrecEquality},
+		Question:         {prefix: nil, infix: (*parser).conditional, precedence: PrecConditional},
+		QuestionQuestion: {prefix: nil, infix: (*parser).binary, precedence: PrecCoalesce},
+		Number:           {prefix: (*parser).literal, infix: nil, precedence: PrecNone},
+		Percent:          {prefix: nil, infix: (*parser).binary, precedence: PrecFactor},
+		Pipe:             {prefix: nil, infix: (*parser).binary, precedence: PrecBitOr},
+		Plus:             {prefix: nil, infix: (*parser).binary, precedence: PrecTerm},
+		PlusPlus:         {prefix: nil, infix: (*parser).postfix, precedence: PrecCall},
+		Or:               {prefix: nil, infix: (*parser).or, precedence: PrecOr},
+		Slash:            {prefix: nil, infix: (*parser).binary, precedence: PrecFactor},
+		Star:             {prefix: nil, infix: (*parser).binary, precedence: PrecFactor},
+		StarStar:         {prefix: nil, infix: (*parser).binary, precedence: PrecExponent},
+		String:           {prefix: (*parser).literal, infix: nil, precedence: PrecNone},
+		Tilde:            {prefix: (*parser).unary, infix: nil, precedence: PrecNone},
+		TildeSlash:       {prefix: nil, infix: (*parser).binary, precedence: PrecFactor},
+		True:             {prefix: (*parser).literal, infix: nil, precedence: PrecNone},
+	}
+
+	if r, ok := rules[tt]; ok {
+		return r
+	}
+
+	return rule{
+		prefix:     nil,
+		infix:      nil,
+		precedence: PrecNone,
+	}
+}
+
+func (p *parser) parsePrecedence(prec precedence) (ast.Expr, error) {
+	last := p.previous
+
+	p.advance()
+
+	prefix := getRule(p.previous.TokenType).prefix
+
+	if prefix == nil {
+		// increments and decrements are postfix only
+		if p.previous.TokenType == PlusPlus || p.previous.TokenType == MinusMinus {
+			return nil, newError(p.previous, "prefix '%s' is not supported, use '%c= 1'", p.previous.Lexeme, p.previous.Lexeme[0])
+		}
+		// nothing precedes the first token of the source
+		if last == nil {
+			return nil, newError(p.previous, "unexpected %s", p.previous.TokenType.Name())
+		}
+		return nil, newError(p.previous, "expected expression after %s", last.TokenType.Name())
+	}
+
+	assignable := prec <= PrecAssignment
+	e, err := prefix(p, assignable)
+	if err != nil {
+		return nil, err
+	}
+
+	for prec <= getRule(p.current.TokenType).precedence {
+		p.advance()
+
+		infix := getRule(p.previous.TokenType).infix
+
+		if e, err = infix(p, e); err != nil {
+			return nil, err
+		}
+	}
+
+	if assignable && isAssignment(p.current.TokenType) {
+		return p.assignment(e)
+	}
+
+	return e, nil
+}
+
+// assignment parses the operator and the value assigned to target, a
+// variable or an element.
+func (p *parser) assignment(target ast.Expr) (ast.Expr, error) {
+	switch target.(type) {
+	case *ast.Ident, *ast.Index:
+	default:
+		return nil, newError(p.current, "invalid assignment target")
+	}
+
+	p.advance()
+	operator := p.previous
+	a := &ast.Assign{Target: target, OpPos: operator.position(), Op: operator.Lexeme}
+
+	var err error
+	if a.Value, err = p.expression(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// postfix parses an increment or a decrement of target, a variable or an
+// element. Unlike the other assignments it binds like a call, so that it can
+// be an operand: x++ + 1.
+func (p *parser) postfix(target ast.Expr) (ast.Expr, error) {
+	operator := p.previous
+	switch target.(type) {
+	case *ast.Ident, *ast.Index:
+	default:
+		return nil, newError(operator, "invalid assignment target")
+	}
+	return &ast.Assign{Target: target, OpPos: operator.position(), Op: operator.Lexeme}, nil
+}
+
+// file parses source up to the end.
+func (p *parser) file() *ast.File {
+	file := &ast.File{}
+
+	p.advance()
+
+	for !p.match(Eof) {
+		if s := p.declaration(); s != nil {
+			file.Statements = append(file.Statements, s)
+		}
+	}
+	file.EOF = p.previous.position()
+
+	return file
+}
+
+// singleExpression parses source as a single expression.
+func (p *parser) singleExpression() ast.Expr {
+	p.advance()
+
+	e, err := p.expression()
+	if err == nil {
+		p.trim(Semicolon, NewLine)
+		err = p.consume(Eof)
+	}
+	if err != nil {
+		p.report(err)
+		return nil
+	}
+
+	return e
+}
+
+func (p *parser) and(left ast.Expr) (ast.Expr, error) {
+	operator := p.previous
+	right, err := p.parsePrecedence(PrecAnd + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Binary{Left: left, OpPos: operator.position(), Op: operator.Lexeme, Right: right}, nil
+}
+
+func (p *parser) or(left ast.Expr) (ast.Expr, error) {
+	operator := p.previous
+	right, err := p.parsePrecedence(PrecOr + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Binary{Left: left, OpPos: operator.position(), Op: operator.Lexeme, Right: right}, nil
+}
+
+// binary parses the right operand of a binary operator. Operators are left
+// associative, 10 - 2 - 3 is (10 - 2) - 3, so the operand is parsed at the
+// next precedence; only ** is right associative.
+func (p *parser) binary(left ast.Expr) (ast.Expr, error) {
+	operator := p.previous
+	prec := getRule(operator.TokenType).precedence
+	if operator.TokenType != StarStar {
+		prec++
+	}
+	right, err := p.parsePrecedence(prec)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Binary{Left: left, OpPos: operator.position(), Op: operator.Lexeme, Right: right}, nil
+}
+
+func (p *parser) conditional(cond ast.Expr) (ast.Expr, error) {
+	e := &ast.Conditional{Cond: cond, Question: p.previous.position()}
+
+	var err error
+	if e.Then, err = p.expression(); err != nil {
+		return nil, err
+	}
+	if err := p.consume(Colon); err != nil {
+		return nil, err
+	}
+	e.Colon = p.previous.position()
+
+	// right-associative, a ? b : c ? d : e is a ? b : (c ? d : e)
+	if e.Else, err = p.parsePrecedence(PrecConditional); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (p *parser) call(callee ast.Expr) (ast.Expr, error) {
+	lparen := p.previous
+	args, err := p.arguments(RightParenthesis)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Call{Callee: callee, Lparen: lparen.position(), Args: args, Rparen: p.previous.position()}, nil
+}
+
+// arguments parses a list of expressions up to the closing token, commas
+// between them are optional.
+func (p *parser) arguments(closing TokenType) ([]ast.Expr, error) {
+	var es []ast.Expr
+	for p.current.TokenType != closing {
+		e, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+		p.trim(Comma)
+	}
+	if err := p.consume(closing); err != nil {
+		return nil, err
+	}
+	return es, nil
+}
+
+func (p *parser) expression() (ast.Expr, error) {
+	return p.parsePrecedence(PrecAssignment)
+}
+
+// declaration parses a statement, on error it is collected and the parser
+// skips to the next statement.
+func (p *parser) declaration() ast.Stmt {
+	if p.match(Semicolon, NewLine, Eof) {
+		return nil
+	}
+
+	s, err := p.statement()
+	if err != nil {
+		p.report(err)
+		p.synchronize()
+		return nil
+	}
+	return s
+}
+
+func (p *parser) grouping(_ bool) (ast.Expr, error) {
+	lparen := p.previous
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(RightParenthesis); err != nil {
+		return nil, err
+	}
+	return &ast.Grouping{Lparen: lparen.position(), Expr: e, Rparen: p.previous.position()}, nil
+}
+
+func (p *parser) literal(_ bool) (ast.Expr, error) {
+	var kind ast.Kind
+	switch p.previous.TokenType {
+	case False:
+		kind = ast.False
+	case Nil:
+		kind = ast.Nil
+	case Number:
+		kind = ast.Number
+	case String:
+		kind = ast.String
+	case True:
+		kind = ast.True
+	}
+	return &ast.Literal{ValuePos: p.previous.position(), Kind: kind, Value: p.previous.Lexeme}, nil
+}
+
+// interpolation parses a string with embedded expressions, whose parts are
+// scanned as Interpolation tokens up to the String token that ends it.
+func (p *parser) interpolation(_ bool) (ast.Expr, error) {
+	e := &ast.Interpolation{}
+	for {
+		e.Parts = append(e.Parts, &ast.Literal{ValuePos: p.previous.position(), Kind: ast.String, Value: p.previous.Lexeme})
+		if p.previous.TokenType == String {
+			return e, nil
+		}
+
+		if (p.check(String) || p.check(Interpolation)) && p.source[p.current.Offset] == '}' {
+			return nil, newError(p.current, "expected expression after '${'")
+		}
+		part, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		e.Parts = append(e.Parts, part)
+
+		if !p.match(Interpolation, String) {
+			return nil, newError(p.current, "expected '}' after interpolated expression")
+		}
+	}
+}
+
+func (p *parser) array(_ bool) (ast.Expr, error) {
+	lsquare := p.previous
+	es, err := p.arguments(RightSquare)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Array{Lsquare: lsquare.position(), Elements: es, Rsquare: p.previous.position()}, nil
+}
+
+func (p *parser) statement() (ast.Stmt, error) {
+	var s ast.Stmt
+	var err error
+
+	switch p.current.TokenType {
+	case Assert:
+		{
+			p.advance()
+			s, err = p.assertStatement()
+		}
+	case For:
+		{
+			p.advance()
+			s, err = p.forStatement()
+		}
+	case Fun:
+		{
+			p.advance()
+			s, err = p.funStatement()
+		}
+	case If:
+		{
+			p.advance()
+			s, err = p.ifStatement()
+		}
+	case LeftBrace:
+		{
+			p.advance()
+			s, err = p.block()
+		}
+	case Print:
+		{
+			p.advance()
+			s, err = p.printStatement()
+		}
+	case Return:
+		{
+			p.advance()
+			s, err = p.returnStatement()
+		}
+	case Var, Let:
+		{
+			p.advance()
+			s, err = p.listVariables()
+		}
+	case While:
+		{
+			p.advance()
+			s, err = p.whileStatement()
+		}
+	default:
+		{
+			e, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+
+			if p.current.TokenType != RightBrace {
+				if err := p.consume(Semicolon, NewLine, Eof); err != nil {
+					return nil, err
+				}
+			}
+
+			return &ast.ExprStmt{Expr: e}, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.trim(Semicolon, NewLine)
+	return s, nil
+}
+
+func (p *parser) assertStatement() (ast.Stmt, error) {
+	keyword := p.previous
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.AssertStmt{Assert: keyword.position(), Expr: e}, nil
+}
+
+func (p *parser) printStatement() (ast.Stmt, error) {
+	keyword := p.previous
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.PrintStmt{Print: keyword.position(), Expr: e}, nil
+}
+
+// block statements parser
+func (p *parser) block() (*ast.BlockStmt, error) {
+	b := &ast.BlockStmt{Lbrace: p.previous.position()}
+
+	for !p.check(RightBrace) && !p.check(Eof) {
+		if s := p.declaration(); s != nil {
+			b.Statements = append(b.Statements, s)
+		}
+	}
+	if err := p.consume(RightBrace); err != nil {
+		return nil, err
+	}
+	b.Rbrace = p.previous.position()
+
+	return b, nil
+}
+
+func (p *parser) unary(_ bool) (ast.Expr, error) {
+	operator := p.previous
+
+	operand, err := p.parsePrecedence(PrecUnary)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.Unary{OpPos: operator.position(), Op: operator.Lexeme, Operand: operand}, nil
+}
+
+// variable declarations parser
+func (p *parser) listVariables() (ast.Stmt, error) {
+	s := &ast.VarStmt{
+		Keyword:    p.previous.position(),
+		Modifiable: p.previous.TokenType == Var,
+	}
+
+	// multiple declarations
+	if p.match(LeftBrace) {
+		s.Lbrace = p.previous.position()
+		p.trim(NewLine)
+		for p.current.TokenType != RightBrace {
+			spec, err := p.variable()
+			if err != nil {
+				return nil, err
+			}
+			s.Specs = append(s.Specs, spec)
+			p.trim(NewLine)
+		}
+		if err := p.consume(RightBrace); err != nil {
+			return nil, err
+		}
+		s.Rbrace = p.previous.position()
+		return s, nil
+	}
+
+	// single declaration
+	spec, err := p.variable()
+	if err != nil {
+		return nil, err
+	}
+	s.Specs = append(s.Specs, spec)
+	return s, nil
+}
+
+func (p *parser) variable() (*ast.VarSpec, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &ast.VarSpec{Name: name}
+	if p.match(Equal) {
+		if spec.Value, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+
+	return spec, nil
+}
+
+// ident consumes an identifier.
+func (p *parser) ident() (*ast.Ident, error) {
+	if err := p.consume(Identifier); err != nil {
+		return nil, err
+	}
+	return &ast.Ident{NamePos: p.previous.position(), Name: p.previous.Lexeme}, nil
+}
+
+// identifier parser
+func (p *parser) identifier(_ bool) (ast.Expr, error) {
+	return &ast.Ident{NamePos: p.previous.position(), Name: p.previous.Lexeme}, nil
+}
+
+// index parses the index or the slice bounds following object.
+func (p *parser) index(object ast.Expr) (ast.Expr, error) {
+	lsquare := p.previous
+
+	var low ast.Expr
+	if !p.check(Colon) {
+		var err error
+		if low, err = p.expression(); err != nil {
+			return nil, err
+		}
+		if p.match(RightSquare) {
+			return &ast.Index{Object: object, Lsquare: lsquare.position(), Index: low, Rsquare: p.previous.position()}, nil
+		}
+	}
+
+	if !p.match(Colon) {
+		return nil, newError(p.current, "expected ']' or ':'")
+	}
+	colon := p.previous
+
+	var high ast.Expr
+	if !p.check(RightSquare) {
+		var err error
+		if high, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.consume(RightSquare); err != nil {
+		return nil, err
+	}
+	return &ast.Slice{Object: object, Lsquare: lsquare.position(), Low: low, Colon: colon.position(), High: high, Rsquare: p.previous.position()}, nil
+}
+
+// property parses the name following a dot.
+func (p *parser) property(object ast.Expr) (ast.Expr, error) {
+	dot := p.previous
+	if err := p.consume(Identifier); err != nil {
+		return nil, err
+	}
+	name := &ast.Ident{NamePos: p.previous.position(), Name: p.previous.Lexeme}
+	return &ast.Property{Object: object, Dot: dot.position(), Name: name}, nil
+}
+
+// isAssignment tells whether tt is one of the assignment operators.
+func isAssignment(tt TokenType) bool {
+	switch tt {
+	case Equal, MinusEqual, PlusEqual, SlashEqual, StarEqual:
+		return true
+	}
+	return false
+}
+
+func (p *parser) funStatement() (ast.Stmt, error) {
+	s := &ast.FunStmt{Fun: p.previous.position()}
+
+	var err error
+	if s.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+
+	if err := p.consume(LeftParenthesis); err != nil {
+		return nil, err
+	}
+
+	for p.current.TokenType != RightParenthesis {
+		p.trim(Var)
+
+		param, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		s.Params = append(s.Params, param)
+
+		p.trim(Comma)
+	}
+
+	if err := p.consume(RightParenthesis); err != nil {
+		return nil, err
+	}
+
+	if err := p.consume(LeftBrace); err != nil {
+		return nil, err
+	}
+
+	if s.Body, err = p.block(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (p *parser) returnStatement() (ast.Stmt, error) {
+	keyword := p.previous
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.ReturnStmt{Return: keyword.position(), Result: e}, nil
+}
+
+func (p *parser) ifStatement() (ast.Stmt, error) {
+	s := &ast.IfStmt{If: p.previous.position()}
+
+	// condition
+	var err error
+	if s.Cond, err = p.expression(); err != nil {
+		return nil, err
+	}
+
+	// then
+	if err := p.consume(LeftBrace); err != nil {
+		return nil, err
+	}
+	if s.Then, err = p.block(); err != nil {
+		return nil, err
+	}
+
+	if p.match(Else) {
+		if err := p.consume(LeftBrace); err != nil {
+			return nil, err
+		}
+		if s.Else, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (p *parser) whileStatement() (ast.Stmt, error) {
+	s := &ast.WhileStmt{While: p.previous.position()}
+
+	// condition
+	var err error
+	if s.Cond, err = p.expression(); err != nil {
+		return nil, err
+	}
+
+	// body
+	if s.Body, err = p.statement(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (p *parser) forStatement() (ast.Stmt, error) {
+	s := &ast.ForStmt{For: p.previous.position()}
+
+	// initializer
+	s.Init = p.declaration()
+
+	// condition
+	var err error
+	if s.Cond, err = p.expression(); err != nil {
+		return nil, err
+	}
+	if err := p.consume(Semicolon); err != nil {
+		return nil, err
+	}
+
+	// increment
+	if s.Post, err = p.expression(); err != nil {
+		return nil, err
+	}
+
+	// body
+	if s.Body, err = p.statement(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
 }
@@ -0,0 +1,190 @@
+package compiler
+
+import (
+	"fmt"
+	"maki/compiler/ast"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tcs := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "Print",
+			in:   "print 1 + 2 * 3",
+			want: "PrintStmt Binary(+) Literal(1) Binary(*) Literal(2) Literal(3)",
+		},
+		{
+			name: "Exponent",
+			in:   "print -2 ** 2 * 3",
+			want: "PrintStmt Binary(*) Unary(-) Binary(**) Literal(2) Literal(2) Literal(3)",
+		},
+		{
+			name: "Bitwise",
+			in:   "print a | b ^ c & ~d << 1 == e",
+			want: "PrintStmt Binary(==) Binary(|) Ident(a) Binary(^) Ident(b) Binary(&) Ident(c) Binary(<<) Unary(~) Ident(d) Literal(1) Ident(e)",
+		},
+		{
+			name: "Conditional",
+			in:   "print a ? b : c ?? d ? e : f or g",
+			want: "PrintStmt Conditional Ident(a) Ident(b) Conditional Binary(??) Ident(c) Ident(d) Ident(e) Binary(or) Ident(f) Ident(g)",
+		},
+		{
+			name: "Interpolation",
+			in:   "print \"a ${x + 1} b ${\"c${y}\"}\"",
+			want: "PrintStmt Interpolation Literal(a ) Binary(+) Ident(x) Literal(1) Literal( b ) Interpolation Literal(c) Ident(y) Literal() Literal()",
+		},
+		{
+			name: "Slices And Methods",
+			in:   "print s[1:n] + s[:2].upper() + s[i:].split(\",\").join(\"\")",
+			want: "PrintStmt Binary(+) Binary(+) Slice Ident(s) Literal(1) Ident(n) Call Property Slice Ident(s) Literal(2) Ident(upper) " +
+				"Call Property Call Property Slice Ident(s) Ident(i) Ident(split) Literal(,) Ident(join) Literal()",
+		},
+		{
+			name: "Membership",
+			in:   "print x in xs == y in s[1:]",
+			want: "PrintStmt Binary(==) Binary(in) Ident(x) Ident(xs) Binary(in) Ident(y) Slice Ident(s) Literal(1)",
+		},
+		{
+			name: "Index",
+			in:   "print m[i][j] + f()[0] + [1, 2][-1] + \"abc\"[1]",
+			want: "PrintStmt Binary(+) Binary(+) Binary(+) Index Index Ident(m) Ident(i) Ident(j) Index Call Ident(f) Literal(0) " +
+				"Index Array Literal(1) Literal(2) Unary(-) Literal(1) Index Literal(abc) Literal(1)",
+		},
+		{
+			name: "Left Associative",
+			in:   "print a - b - c ~/ d ~/ e >> f >> g and h and i",
+			want: "PrintStmt Binary(and) Binary(and) Binary(>>) Binary(>>) Binary(-) Binary(-) Ident(a) Ident(b) " +
+				"Binary(~/) Binary(~/) Ident(c) Ident(d) Ident(e) Ident(f) Ident(g) Ident(h) Ident(i)",
+		},
+		{
+			name: "Right Associative Power",
+			in:   "print a ** b ** c",
+			want: "PrintStmt Binary(**) Ident(a) Binary(**) Ident(b) Ident(c)",
+		},
+		{
+			name: "Logical",
+			in:   "a and b or c",
+			want: "ExprStmt Binary(or) Binary(and) Ident(a) Ident(b) Ident(c)",
+		},
+		{
+			name: "Assignment",
+			in:   "xs[i] = -f(x, \"y\")",
+			want: "ExprStmt Assign Index Ident(xs) Ident(i) Unary(-) Call Ident(f) Ident(x) Literal(y)",
+		},
+		{
+			name: "Compound Assignment",
+			in:   "xs[i] *= n + 1\nfor ; i < 3; i++ { n-- }",
+			want: "ExprStmt Assign Index Ident(xs) Ident(i) Binary(+) Ident(n) Literal(1) " +
+				"ForStmt Binary(<) Ident(i) Literal(3) Assign Ident(i) BlockStmt ExprStmt Assign Ident(n)",
+		},
+		{
+			name: "Nested Assignment",
+			in:   "m[i][j] += f()[0]",
+			want: "ExprStmt Assign Index Index Ident(m) Ident(i) Ident(j) Index Call Ident(f) Literal(0)",
+		},
+		{
+			name: "Postfix Operand",
+			in:   "print x++ * 2 + -xs[i]--",
+			want: "PrintStmt Binary(+) Binary(*) Assign Ident(x) Literal(2) Unary(-) Assign Index Ident(xs) Ident(i)",
+		},
+		{
+			name: "Variables",
+			in:   "let {\n    a = 1\n    b\n}",
+			want: "VarStmt VarSpec Ident(a) Literal(1) VarSpec Ident(b)",
+		},
+		{
+			name: "Function",
+			in:   "fun f(a, var b) {\n    return (a)\n}",
+			want: "FunStmt Ident(f) Ident(a) Ident(b) BlockStmt ReturnStmt Grouping Ident(a)",
+		},
+		{
+			name: "Control Flow",
+			in:   "for var i = 0; i < 3; i = i + 1 {\n    if i == 1 { print [i] } else { assert true }\n}\nwhile nil print 1",
+			want: "ForStmt VarStmt VarSpec Ident(i) Literal(0) Binary(<) Ident(i) Literal(3) Assign Ident(i) Binary(+) Ident(i) Literal(1) " +
+				"BlockStmt IfStmt Binary(==) Ident(i) Literal(1) BlockStmt PrintStmt Array Ident(i) BlockStmt AssertStmt Literal(true) " +
+				"WhileStmt Literal(nil) PrintStmt Literal(1)",
+		},
+		{
+			name: "Skip Errors",
+			in:   "print 1 +\nprint 2",
+			want: "PrintStmt Literal(2)",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			file, _ := Parse(tc.in)
+
+			var nodes []string
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case nil, *ast.File:
+				case *ast.Ident:
+					nodes = append(nodes, fmt.Sprintf("Ident(%s)", n.Name))
+				case *ast.Literal:
+					nodes = append(nodes, fmt.Sprintf("Literal(%s)", n.Value))
+				case *ast.Unary:
+					nodes = append(nodes, fmt.Sprintf("Unary(%s)", n.Op))
+				case *ast.Binary:
+					nodes = append(nodes, fmt.Sprintf("Binary(%s)", n.Op))
+				default:
+					nodes = append(nodes, strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."))
+				}
+				return true
+			})
+
+			if got := strings.Join(nodes, " "); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParse_Positions(t *testing.T) {
+	file, err := Parse("var x = [1, 2]\nif x {\n    print x[0]\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name string
+		node ast.Node
+		pos  ast.Position
+		end  ast.Position
+	}{
+		{
+			name: "Variable",
+			node: file.Statements[0],
+			pos:  ast.Position{Line: 1, Column: 1, Offset: 0, Length: 3},
+			end:  ast.Position{Line: 1, Column: 14, Offset: 13, Length: 1},
+		},
+		{
+			name: "If",
+			node: file.Statements[1],
+			pos:  ast.Position{Line: 2, Column: 1, Offset: 15, Length: 2},
+			end:  ast.Position{Line: 4, Column: 1, Offset: 37, Length: 1},
+		},
+		{
+			name: "Index",
+			node: file.Statements[1].(*ast.IfStmt).Then.Statements[0].(*ast.PrintStmt).Expr,
+			pos:  ast.Position{Line: 3, Column: 11, Offset: 32, Length: 1},
+			end:  ast.Position{Line: 3, Column: 14, Offset: 35, Length: 1},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.node.Pos(); got != tc.pos {
+				t.Errorf("got %+v, want %+v", got, tc.pos)
+			}
+			if got := tc.node.End(); got != tc.end {
+				t.Errorf("got %+v, want %+v", got, tc.end)
+			}
+		})
+	}
+}
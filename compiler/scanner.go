@@ -1,13 +1,24 @@
 package compiler
 
-import "fmt"
+import (
+	"fmt"
+	"maki/compiler/ast"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 type TokenType string
 
 const (
-	And              TokenType = "AND"
+	Ampersand        TokenType = "AMPERSAND"
+	And                        = "AND"
+	Caret                      = "CARET"
 	Class                      = "CLASS"
+	Colon                      = "COLON"
 	Comma                      = "COMMA"
+	Comment                    = "COMMENT"
 	Dot                        = "DOT"
 	Else                       = "ELSE"
 	Eof                        = "EOF"
@@ -18,23 +29,35 @@ const (
 	Fun                        = "FUN"
 	Greater                    = "GREATER"
 	GreaterEqual               = "GREATER_EQUAL"
+	GreaterGreater             = "GREATER_GREATER"
 	Identifier                 = "IDENTIFIER"
 	If                         = "IF"
+	In                         = "IN"
+	Interpolation              = "INTERPOLATION"
 	LeftBrace                  = "LEFT_BRACE"
 	LeftParenthesis            = "LEFT_PARENTHESIS"
 	LeftSquare                 = "LEFT_SQUARE"
 	Less                       = "LESS"
 	LessEqual                  = "LESS_EQUAL"
+	LessLess                   = "LESS_LESS"
 	Let                        = "LET"
 	Minus                      = "MINUS"
+	MinusEqual                 = "MINUS_EQUAL"
+	MinusMinus                 = "MINUS_MINUS"
 	NewLine                    = "NEW_LINE"
 	Nil                        = "NIL"
 	Not                        = "NOT"
 	NotEqual                   = "NOT_EQUAL"
 	Number                     = "NUMBER"
 	Or                         = "OR"
+	Percent                    = "PERCENT"
+	Pipe                       = "PIPE"
 	Plus                       = "PLUS"
+	PlusEqual                  = "PLUS_EQUAL"
+	PlusPlus                   = "PLUS_PLUS"
 	Print                      = "PRINT"
+	Question                   = "QUESTION"
+	QuestionQuestion           = "QUESTION_QUESTION"
 	Assert                     = "ASSERT"
 	Return                     = "RETURN"
 	RightBrace                 = "RIGHT_BRACE"
@@ -42,10 +65,15 @@ const (
 	RightSquare                = "RIGHT_SQUARE"
 	Semicolon                  = "SEMICOLON"
 	Slash                      = "SLASH"
+	SlashEqual                 = "SLASH_EQUAL"
 	Star                       = "STAR"
+	StarEqual                  = "STAR_EQUAL"
+	StarStar                   = "STAR_STAR"
 	String                     = "STRING"
 	Super                      = "SUPER"
 	This                       = "THIS"
+	Tilde                      = "TILDE"
+	TildeSlash                 = "TILDE_SLASH"
 	True                       = "TRUE"
 	Var                        = "VAR"
 	While                      = "WHILE"
@@ -60,6 +88,7 @@ var keywords = map[string]TokenType{
 	"fun":    Fun,
 	"for":    For,
 	"if":     If,
+	"in":     In,
 	"nil":    Nil,
 	"let":    Let,
 	"or":     Or,
@@ -72,10 +101,100 @@ var keywords = map[string]TokenType{
 	"while":  While,
 }
 
+// Keywords returns the reserved words of the language, sorted.
+func Keywords() []string {
+	ks := make([]string, 0, len(keywords))
+	for k := range keywords {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+// names are the token types as they are written in source code, used in
+// error messages.
+var names = map[TokenType]string{
+	Ampersand:        "'&'",
+	Caret:            "'^'",
+	Colon:            "':'",
+	Comma:            "','",
+	Comment:          "comment",
+	Dot:              "'.'",
+	Eof:              "end of file",
+	Equal:            "'='",
+	EqualEqual:       "'=='",
+	Greater:          "'>'",
+	GreaterEqual:     "'>='",
+	GreaterGreater:   "'>>'",
+	Identifier:       "identifier",
+	Interpolation:    "string",
+	LeftBrace:        "'{'",
+	LeftParenthesis:  "'('",
+	LeftSquare:       "'['",
+	Less:             "'<'",
+	LessEqual:        "'<='",
+	LessLess:         "'<<'",
+	Minus:            "'-'",
+	MinusEqual:       "'-='",
+	MinusMinus:       "'--'",
+	NewLine:          "new line",
+	Not:              "'!'",
+	NotEqual:         "'!='",
+	Number:           "number",
+	Percent:          "'%'",
+	Pipe:             "'|'",
+	Question:         "'?'",
+	QuestionQuestion: "'??'",
+	Plus:             "'+'",
+	PlusEqual:        "'+='",
+	PlusPlus:         "'++'",
+	RightBrace:       "'}'",
+	RightParenthesis: "')'",
+	RightSquare:      "']'",
+	Semicolon:        "';'",
+	Slash:            "'/'",
+	SlashEqual:       "'/='",
+	Star:             "'*'",
+	StarEqual:        "'*='",
+	StarStar:         "'**'",
+	String:           "string",
+	Tilde:            "'~'",
+	TildeSlash:       "'~/'",
+}
+
+// Name returns the token type in a human-friendly form, e.g. ')' instead of
+// RIGHT_PARENTHESIS.
+func (tt TokenType) Name() string {
+	if name, ok := names[tt]; ok {
+		return name
+	}
+
+	for keyword, t := range keywords {
+		if t == tt {
+			return "'" + keyword + "'"
+		}
+	}
+
+	return string(tt)
+}
+
 type Token struct {
 	TokenType
 	Lexeme string
 	Line   int
+	Column int
+	Offset int // position of the first character in source
+	Length int // number of characters, quotes included
+}
+
+// position returns where the token is in source.
+func (t *Token) position() ast.Position {
+	return ast.Position{
+		Line:   t.Line,
+		Column: t.Column,
+		Offset: t.Offset,
+		Length: t.Length,
+	}
 }
 
 func (t Token) String() string {
@@ -83,10 +202,19 @@ func (t Token) String() string {
 }
 
 type scanner struct {
-	source  []rune
-	start   int
-	current int
-	line    int
+	source       []rune
+	start        int
+	current      int
+	line         int
+	lineStart    int  // offset of the first character of the current line
+	unterminated bool // source ended inside a string or a comment
+	comments     bool // return comments as tokens instead of skipping them
+	// braces opened in each interpolated expression being scanned, the
+	// string goes on at the brace closing the expression
+	interpolations []int
+	// position of the token being scanned
+	startLine   int
+	startColumn int
 }
 
 func newScanner(s string) *scanner {
@@ -98,6 +226,38 @@ func newScanner(s string) *scanner {
 	}
 }
 
+func (s *scanner) error(format string, args ...interface{}) *Error {
+	return &Error{
+		Line:    s.startLine,
+		Column:  s.startColumn,
+		Length:  s.current - s.start,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// errorAt returns an error for the characters of the token being scanned
+// starting at offset.
+func (s *scanner) errorAt(offset, length int, format string, args ...interface{}) *Error {
+	line, column := s.startLine, s.startColumn+offset-s.start
+	for i := s.start; i < offset; i++ {
+		if s.source[i] == '\n' {
+			line, column = line+1, offset-i
+		}
+	}
+
+	return &Error{
+		Line:    line,
+		Column:  column,
+		Length:  length,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (s *scanner) newLine() {
+	s.line++
+	s.lineStart = s.current
+}
+
 func (s *scanner) Scan() ([]Token, error) {
 	ts := make([]Token, 0)
 
@@ -116,15 +276,49 @@ func (s *scanner) Scan() ([]Token, error) {
 	}
 }
 
+// IsComplete reports whether source is ready to be compiled, that is it has
+// no unclosed braces, brackets, parentheses, strings or multi-line comments.
+// Any other error is left to the compiler, so source is considered complete.
+func IsComplete(source string) bool {
+	s := newScanner(source)
+	depth := 0
+
+	for {
+		t, err := s.scanToken()
+		if err != nil {
+			return !s.unterminated
+		}
+
+		switch t.TokenType {
+		case LeftBrace, LeftParenthesis, LeftSquare:
+			depth++
+		case RightBrace, RightParenthesis, RightSquare:
+			depth--
+		case Eof:
+			return depth <= 0
+		}
+	}
+}
+
 func (s *scanner) scanToken() (*Token, error) {
 	s.start = s.current
 	s.trim()
 
+	s.startLine = s.line
+	s.startColumn = s.start - s.lineStart + 1
+
 	if s.isEnd() {
+		if len(s.interpolations) > 0 {
+			s.interpolations = nil
+			s.unterminated = true
+			return nil, s.error("unterminated string")
+		}
 		eof := &Token{
 			TokenType: Eof,
 			Lexeme:    "",
 			Line:      s.line,
+			Column:    s.startColumn,
+			Offset:    s.start,
 		}
 		return eof, nil
 	}
@@ -134,7 +328,7 @@ func (s *scanner) scanToken() (*Token, error) {
 	case '\n':
 		{
 			t := s.makeToken(NewLine)
-			s.line++
+			s.newLine()
 			return t, nil
 		}
 	case '(':
@@ -147,10 +341,20 @@ func (s *scanner) scanToken() (*Token, error) {
 		}
 	case '{':
 		{
+			if n := len(s.interpolations); n > 0 {
+				s.interpolations[n-1]++
+			}
 			return s.makeToken(LeftBrace), nil
 		}
 	case '}':
 		{
+			if n := len(s.interpolations); n > 0 {
+				if s.interpolations[n-1] == 0 {
+					s.interpolations = s.interpolations[:n-1]
+					return s.scanString()
+				}
+				s.interpolations[n-1]--
+			}
 			return s.makeToken(RightBrace), nil
 		}
 	case '[':
@@ -173,19 +377,71 @@ func (s *scanner) scanToken() (*Token, error) {
 		{
 			return s.makeToken(Dot), nil
 		}
+	case '%':
+		{
+			return s.makeToken(Percent), nil
+		}
+	case '&':
+		{
+			return s.makeToken(Ampersand), nil
+		}
+	case '|':
+		{
+			return s.makeToken(Pipe), nil
+		}
+	case '^':
+		{
+			return s.makeToken(Caret), nil
+		}
+	case '~':
+		{
+			if s.isNext('/') {
+				return s.makeToken(TildeSlash), nil
+			}
+			return s.makeToken(Tilde), nil
+		}
+	case ':':
+		{
+			return s.makeToken(Colon), nil
+		}
+	// Multi-character lexeme
+	case '?':
+		{
+			if s.isNext('?') {
+				return s.makeToken(QuestionQuestion), nil
+			}
+			return s.makeToken(Question), nil
+		}
 	case '+':
 		{
+			if s.isNext('+') {
+				return s.makeToken(PlusPlus), nil
+			}
+			if s.isNext('=') {
+				return s.makeToken(PlusEqual), nil
+			}
 			return s.makeToken(Plus), nil
 		}
 	case '-':
 		{
+			if s.isNext('-') {
+				return s.makeToken(MinusMinus), nil
+			}
+			if s.isNext('=') {
+				return s.makeToken(MinusEqual), nil
+			}
 			return s.makeToken(Minus), nil
 		}
 	case '*':
 		{
+			if s.isNext('*') {
+				return s.makeToken(StarStar), nil
+			}
+			if s.isNext('=') {
+				return s.makeToken(StarEqual), nil
+			}
 			return s.makeToken(Star), nil
 		}
-	// Multi-character lexeme
 	case '!':
 		{
 			if s.isNext('=') {
@@ -205,6 +461,9 @@ func (s *scanner) scanToken() (*Token, error) {
 			if s.isNext('=') {
 				return s.makeToken(GreaterEqual), nil
 			}
+			if s.isNext('>') {
+				return s.makeToken(GreaterGreater), nil
+			}
 			return s.makeToken(Greater), nil
 		}
 	case '<':
@@ -212,6 +471,9 @@ func (s *scanner) scanToken() (*Token, error) {
 			if s.isNext('=') {
 				return s.makeToken(LessEqual), nil
 			}
+			if s.isNext('<') {
+				return s.makeToken(LessLess), nil
+			}
 			return s.makeToken(Less), nil
 		}
 	case '/':
@@ -220,8 +482,15 @@ func (s *scanner) scanToken() (*Token, error) {
 		}
 	case '"':
 		{
+			if s.peek() == '"' && s.peekNext() == '"' {
+				return s.scanMultiLineString()
+			}
 			return s.scanString()
 		}
+	case '`':
+		{
+			return s.scanRawString()
+		}
 	default:
 		{
 			if isDigit(r) {
@@ -230,7 +499,7 @@ func (s *scanner) scanToken() (*Token, error) {
 			if isLetter(r) {
 				return s.scanIdentifier()
 			}
-			return nil, fmt.Errorf("scanner error, unknown character '%v' [line %d]", string(r), s.line)
+			return nil, s.error("unknown character '%v'", string(r))
 		}
 	}
 }
@@ -241,6 +510,9 @@ func (s *scanner) scanComment() (*Token, error) {
 		for s.peek() != '\n' && !s.isEnd() {
 			_ = s.advance()
 		}
+		if s.comments {
+			return s.makeToken(Comment), nil
+		}
 		return s.scanToken()
 	}
 
@@ -248,20 +520,24 @@ func (s *scanner) scanComment() (*Token, error) {
 	if s.isNext('*') {
 		for {
 			if s.isEnd() {
-				return nil, fmt.Errorf("scanner error, comment not terminated [line %d]", s.line)
+				s.unterminated = true
+				return nil, s.error("comment not terminated")
 			}
 
 			r := s.advance()
 			switch r {
 			case '\n':
 				{
-					s.line++
+					s.newLine()
 					break
 				}
 			case '*':
 				{
 					if s.peek() == '/' {
 						_ = s.advance()
+						if s.comments {
+							return s.makeToken(Comment), nil
+						}
 						return s.scanToken()
 					}
 				}
@@ -269,28 +545,213 @@ func (s *scanner) scanComment() (*Token, error) {
 		}
 	}
 
+	if s.isNext('=') {
+		return s.makeToken(SlashEqual), nil
+	}
 	return s.makeToken(Slash), nil
 }
 
+// scanString scans a string between double quotes, or the part of it
+// following an interpolated expression. A part followed by ${ is returned as
+// Interpolation, the tokens of the expression come next.
 func (s *scanner) scanString() (*Token, error) {
 	for s.peek() != '"' && !s.isEnd() {
-		if s.peek() == '\n' {
-			s.line++
+		if s.peek() == '$' && s.peekNext() == '{' {
+			s.advance()
+			s.advance()
+			s.interpolations = append(s.interpolations, 0)
+
+			value, err := s.unescape(s.start+1, s.current-2)
+			if err != nil {
+				return nil, err
+			}
+			t := s.makeString(value)
+			t.TokenType = Interpolation
+			return t, nil
+		}
+
+		r := s.advance()
+		if r == '\\' && !s.isEnd() {
+			r = s.advance()
+		}
+		if r == '\n' {
+			s.newLine()
+		}
+	}
+
+	if s.isEnd() {
+		s.unterminated = true
+		return nil, s.error("unterminated string")
+	}
+	_ = s.advance()
+
+	value, err := s.unescape(s.start+1, s.current-1)
+	if err != nil {
+		return nil, err
+	}
+	return s.makeString(value), nil
+}
+
+// scanRawString scans a string between backticks, which is taken as is.
+func (s *scanner) scanRawString() (*Token, error) {
+	for s.peek() != '`' && !s.isEnd() {
+		if s.advance() == '\n' {
+			s.newLine()
 		}
-		_ = s.advance()
 	}
 
 	if s.isEnd() {
-		return nil, fmt.Errorf("scanner error, unterminated string [line %d]", s.line)
+		s.unterminated = true
+		return nil, s.error("unterminated string")
 	}
 	_ = s.advance()
 
-	t := &Token{
+	return s.makeString(string(s.source[s.start+1 : s.current-1])), nil
+}
+
+// scanMultiLineString scans a string between triple quotes. The lines holding
+// only the quotes are left out and the indentation common to the other lines,
+// and to the closing quotes, is stripped, so that the string can be indented
+// with the code around it.
+func (s *scanner) scanMultiLineString() (*Token, error) {
+	s.advance()
+	s.advance()
+
+	for !s.isEnd() && !(s.peek() == '"' && s.peekNext() == '"' && s.peekAt(2) == '"') {
+		r := s.advance()
+		if r == '\\' && !s.isEnd() {
+			r = s.advance()
+		}
+		if r == '\n' {
+			s.newLine()
+		}
+	}
+
+	if s.isEnd() {
+		s.unterminated = true
+		return nil, s.error("unterminated string")
+	}
+	s.advance()
+	s.advance()
+	s.advance()
+
+	// offsets of the lines between the quotes
+	type line struct{ from, to int }
+	var lines []line
+	from := s.start + 3
+	for i := from; i < s.current-3; i++ {
+		if s.source[i] == '\n' {
+			lines = append(lines, line{from, i})
+			from = i + 1
+		}
+	}
+	lines = append(lines, line{from, s.current - 3})
+	if len(lines) == 1 {
+		value, err := s.unescape(from, s.current-3)
+		if err != nil {
+			return nil, err
+		}
+		return s.makeString(value), nil
+	}
+
+	for i := range lines {
+		if lines[i].to > lines[i].from && s.source[lines[i].to-1] == '\r' {
+			lines[i].to--
+		}
+	}
+
+	blank := func(l line) bool {
+		return strings.TrimSpace(string(s.source[l.from:l.to])) == ""
+	}
+	indentation := func(l line) int {
+		n := 0
+		for l.from+n < l.to && (s.source[l.from+n] == ' ' || s.source[l.from+n] == '\t') {
+			n++
+		}
+		return n
+	}
+
+	// the indentation of the closing quotes counts even if the line is blank
+	closing := lines[len(lines)-1]
+	indent := -1
+	if blank(closing) {
+		indent = closing.to - closing.from
+		lines = lines[:len(lines)-1]
+	}
+	if blank(lines[0]) {
+		lines = lines[1:]
+	}
+	for _, l := range lines {
+		if n := indentation(l); !blank(l) && (indent < 0 || n < indent) {
+			indent = n
+		}
+	}
+
+	values := make([]string, len(lines))
+	for i, l := range lines {
+		if blank(l) {
+			continue
+		}
+		value, err := s.unescape(l.from+indent, l.to)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	return s.makeString(strings.Join(values, "\n")), nil
+}
+
+func (s *scanner) makeString(value string) *Token {
+	return &Token{
 		TokenType: String,
-		Lexeme:    string(s.source[s.start+1 : s.current-1]),
-		Line:      s.line,
+		Lexeme:    value,
+		Line:      s.startLine,
+		Column:    s.startColumn,
+		Offset:    s.start,
+		Length:    s.current - s.start,
+	}
+}
+
+// unescape returns the characters of source between offsets from and to,
+// replacing the escape sequences, which are the ones of Go strings and \$.
+func (s *scanner) unescape(from, to int) (string, error) {
+	var b strings.Builder
+	for i := from; i < to; {
+		if s.source[i] != '\\' {
+			b.WriteRune(s.source[i])
+			i++
+			continue
+		}
+		if i+1 < to && s.source[i+1] == '$' {
+			b.WriteByte('$')
+			i += 2
+			continue
+		}
+
+		// \U0010FFFF is the longest escape sequence
+		end := i + 10
+		if end > to {
+			end = to
+		}
+		sequence := string(s.source[i:end])
+		r, multibyte, tail, err := strconv.UnquoteChar(sequence, '"')
+		if err != nil {
+			end = i + 2
+			if end > to {
+				end = to
+			}
+			return "", s.errorAt(i, end-i, "invalid escape sequence '%s'", string(s.source[i:end]))
+		}
+
+		if r < utf8.RuneSelf || !multibyte {
+			b.WriteByte(byte(r))
+		} else {
+			b.WriteRune(r)
+		}
+		i += utf8.RuneCountInString(sequence) - utf8.RuneCountInString(tail)
 	}
-	return t, nil
+	return b.String(), nil
 }
 
 func (s *scanner) scanDigit() (*Token, error) {
@@ -306,6 +767,11 @@ func (s *scanner) scanDigit() (*Token, error) {
 		}
 	}
 
+	// suffixes of big integers and decimals
+	if (s.peek() == 'n' || s.peek() == 'd') && !isLetter(s.peekNext()) && !isDigit(s.peekNext()) {
+		s.advance()
+	}
+
 	return s.makeToken(Number), nil
 }
 
@@ -332,11 +798,19 @@ func (s *scanner) peek() rune {
 	return s.source[s.current]
 }
 
+// peekAt returns the character n positions after the current one.
+func (s *scanner) peekAt(n int) rune {
+	if s.current+n >= len(s.source) {
+		return '\x00'
+	}
+	return s.source[s.current+n]
+}
+
 func (s *scanner) peekNext() rune {
 	if s.current+1 >= len(s.source) {
 		return '\x00'
 	}
-	return s.source[s.current-1]
+	return s.source[s.current+1]
 }
 
 func (s *scanner) advance() rune {
@@ -376,8 +850,9 @@ func isDigit(r rune) bool {
 	return false
 }
 
+// isLetter tells whether r can start an identifier, underscore included.
 func isLetter(r rune) bool {
-	if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+	if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' {
 		return true
 	}
 
@@ -388,6 +863,9 @@ func (s *scanner) makeToken(tt TokenType) *Token {
 	return &Token{
 		TokenType: tt,
 		Lexeme:    string(s.source[s.start:s.current]),
-		Line:      s.line,
+		Line:      s.startLine,
+		Column:    s.startColumn,
+		Offset:    s.start,
+		Length:    s.current - s.start,
 	}
 }
@@ -58,8 +58,8 @@ func TestScanner_Scan(t *testing.T) {
 		},
 		{
 			name: "Conditional Keywords Tokens",
-			in:   "if else for while",
-			out:  []TokenType{If, Else, For, While, Eof},
+			in:   "if else for while in",
+			out:  []TokenType{If, Else, For, While, In, Eof},
 		},
 		{
 			name: "Function Keywords Tokens",
@@ -76,6 +76,36 @@ func TestScanner_Scan(t *testing.T) {
 			in:   "print x",
 			out:  []TokenType{Print, Identifier, Eof},
 		},
+		{
+			name: "Identifiers With Underscore",
+			in:   "bench_fib _x x_1",
+			out:  []TokenType{Identifier, Identifier, Identifier, Eof},
+		},
+		{
+			name: "Operators",
+			in:   "% ** * ~/ & | ^ ~ << < <= >> > >=",
+			out:  []TokenType{Percent, StarStar, Star, TildeSlash, Ampersand, Pipe, Caret, Tilde, LessLess, Less, LessEqual, GreaterGreater, Greater, GreaterEqual, Eof},
+		},
+		{
+			name: "Assignment Operators",
+			in:   "+= -= *= /= ++ -- + - * / // comment",
+			out:  []TokenType{PlusEqual, MinusEqual, StarEqual, SlashEqual, PlusPlus, MinusMinus, Plus, Minus, Star, Slash, Eof},
+		},
+		{
+			name: "Conditional Operators",
+			in:   "a ? b : c ?? d",
+			out:  []TokenType{Identifier, Question, Identifier, Colon, Identifier, QuestionQuestion, Identifier, Eof},
+		},
+		{
+			name: "Interpolation",
+			in:   "\"a ${ {x} } b ${\"${y}\"}\\${z}\" }",
+			out:  []TokenType{Interpolation, LeftBrace, Identifier, RightBrace, Interpolation, Interpolation, Identifier, String, String, RightBrace, Eof},
+		},
+		{
+			name: "Number Suffixes",
+			in:   "10n 0.5d 1.5 1. 2do",
+			out:  []TokenType{Number, Number, Number, Number, Dot, Number, Identifier, Eof},
+		},
 		{
 			name: "Assert",
 			in:   "assert false",
@@ -100,3 +130,219 @@ func TestScanner_Scan(t *testing.T) {
 		})
 	}
 }
+
+func TestIsComplete(t *testing.T) {
+	tcs := []struct {
+		name string
+		in   string
+		out  bool
+	}{
+		{
+			name: "Expression",
+			in:   "print 1 + 2\n",
+			out:  true,
+		},
+		{
+			name: "Unclosed Brace",
+			in:   "fun f() {\n",
+			out:  false,
+		},
+		{
+			name: "Closed Brace",
+			in:   "fun f() {\n  print 42\n}\n",
+			out:  true,
+		},
+		{
+			name: "Unclosed Parenthesis",
+			in:   "print (1 +\n",
+			out:  false,
+		},
+		{
+			name: "Unclosed Square",
+			in:   "var a = [ 1, 2,\n",
+			out:  false,
+		},
+		{
+			name: "Unterminated String",
+			in:   "print \"Hello,\n",
+			out:  false,
+		},
+		{
+			name: "Unterminated Raw String",
+			in:   "print `Hello,\n",
+			out:  false,
+		},
+		{
+			name: "Unterminated Multi-Line String",
+			in:   "print \"\"\"\n    Hello,\"\"\n",
+			out:  false,
+		},
+		{
+			name: "Unterminated Interpolation",
+			in:   "print \"Hello, ${\n",
+			out:  false,
+		},
+		{
+			name: "Braces In Interpolation",
+			in:   "print \"${ {} }\"\n",
+			out:  true,
+		},
+		{
+			name: "Unterminated Comment",
+			in:   "/* This text have to be ignored\n",
+			out:  false,
+		},
+		{
+			name: "Brace In String",
+			in:   "print \"{\"\n",
+			out:  true,
+		},
+		{
+			name: "Extra Closing Brace",
+			in:   "}\n",
+			out:  true,
+		},
+		{
+			name: "Unknown Character",
+			in:   "print @",
+			out:  true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsComplete(tc.in); got != tc.out {
+				t.Errorf("got %v, want %v", got, tc.out)
+			}
+		})
+	}
+}
+
+func TestScanner_Strings(t *testing.T) {
+	tcs := []struct {
+		name string
+		in   string
+		out  string
+		err  *Error
+	}{
+		{
+			name: "Escapes",
+			in:   `"\t\"quoted\"\n\\"`,
+			out:  "\t\"quoted\"\n\\",
+		},
+		{
+			name: "Unicode Escapes",
+			in:   `"\u00e8 \U0001F431 \x41"`,
+			out:  "è 🐱 A",
+		},
+		{
+			name: "Invalid Escape",
+			in:   "\"a\nb \\q\"",
+			err:  &Error{Line: 2, Column: 3, Length: 2, Message: "invalid escape sequence '\\q'"},
+		},
+		{
+			name: "Invalid Unicode Escape",
+			in:   `"\u12"`,
+			err:  &Error{Line: 1, Column: 2, Length: 2, Message: "invalid escape sequence '\\u'"},
+		},
+		{
+			name: "Raw String",
+			in:   "`C:\\new\n${x}`",
+			out:  "C:\\new\n${x}",
+		},
+		{
+			name: "Multi-Line String",
+			in:   "\"\"\"\n    Hello,\n\n      \"World\"\\t\n    \"\"\"",
+			out:  "Hello,\n\n  \"World\"\t",
+		},
+		{
+			name: "Multi-Line String Closing Indentation",
+			in:   "\"\"\"\n    Hello,\n  \"\"\"",
+			out:  "  Hello,",
+		},
+		{
+			name: "Multi-Line String On One Line",
+			in:   `"""  "Maki" """`,
+			out:  `  "Maki" `,
+		},
+		{
+			name: "Escaped Interpolation",
+			in:   `"\${x} $x {x}"`,
+			out:  "${x} $x {x}",
+		},
+		{
+			name: "Empty String",
+			in:   `""`,
+			out:  "",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, err := newScanner(tc.in).Scan()
+			if tc.err != nil {
+				if e, ok := err.(*Error); !ok || *e != *tc.err {
+					t.Fatalf("got %v, want %v", err, tc.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("got %v, want nil", err.Error())
+			}
+			if tokens[0].TokenType != String || tokens[0].Lexeme != tc.out {
+				t.Errorf("got %v %q, want %q", tokens[0].TokenType, tokens[0].Lexeme, tc.out)
+			}
+		})
+	}
+}
+
+func TestScanner_Positions(t *testing.T) {
+	tokens, err := newScanner("var x = \"Maki\"\n  print x").Scan()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err.Error())
+	}
+
+	want := []Token{
+		{TokenType: Var, Lexeme: "var", Line: 1, Column: 1, Offset: 0, Length: 3},
+		{TokenType: Identifier, Lexeme: "x", Line: 1, Column: 5, Offset: 4, Length: 1},
+		{TokenType: Equal, Lexeme: "=", Line: 1, Column: 7, Offset: 6, Length: 1},
+		{TokenType: String, Lexeme: "Maki", Line: 1, Column: 9, Offset: 8, Length: 6},
+		{TokenType: NewLine, Lexeme: "\n", Line: 1, Column: 15, Offset: 14, Length: 1},
+		{TokenType: Print, Lexeme: "print", Line: 2, Column: 3, Offset: 17, Length: 5},
+		{TokenType: Identifier, Lexeme: "x", Line: 2, Column: 9, Offset: 23, Length: 1},
+		{TokenType: Eof, Lexeme: "", Line: 2, Column: 10, Offset: 24, Length: 0},
+	}
+
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+
+	for i := range tokens {
+		if tokens[i] != want[i] {
+			t.Errorf("got %+v, want %+v", tokens[i], want[i])
+		}
+	}
+}
+
+func TestTokenType_Name(t *testing.T) {
+	tcs := []struct {
+		in  TokenType
+		out string
+	}{
+		{in: RightParenthesis, out: "')'"},
+		{in: EqualEqual, out: "'=='"},
+		{in: Fun, out: "'fun'"},
+		{in: Identifier, out: "identifier"},
+		{in: NewLine, out: "new line"},
+		{in: Eof, out: "end of file"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(string(tc.in), func(t *testing.T) {
+			if got := tc.in.Name(); got != tc.out {
+				t.Errorf("got %v, want %v", got, tc.out)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package compiler
 
-import "fmt"
+import (
+	"maki/compiler/ast"
+	"maki/vm"
+)
 
 const size = 256
 
@@ -12,6 +15,7 @@ type local struct {
 
 type scope struct {
 	globals map[string]bool // keep track of global constants
+	symbols *vm.Symbols     // slots of globals, defined or not
 	locals  [size]local
 	count   int
 	depth   int
@@ -20,11 +24,38 @@ type scope struct {
 func newScope() *scope {
 	return &scope{
 		globals: make(map[string]bool),
+		symbols: vm.NewSymbols(),
 		count:   0,
 		depth:   0,
 	}
 }
 
+// snapshot is the state of a scope before compiling some source.
+type snapshot struct {
+	globals map[string]bool
+	symbols int
+	count   int
+	depth   int
+}
+
+// save returns the current state of s, to restore if compiling fails.
+func (s *scope) save() snapshot {
+	globals := make(map[string]bool, len(s.globals))
+	for g, modifiable := range s.globals {
+		globals[g] = modifiable
+	}
+	return snapshot{globals: globals, symbols: s.symbols.Len(), count: s.count, depth: s.depth}
+}
+
+// restore forgets the variables declared since snapshot was saved, so that
+// the declarations of code that failed to compile do not linger.
+func (s *scope) restore(snapshot snapshot) {
+	s.globals = snapshot.globals
+	s.symbols.Truncate(snapshot.symbols)
+	s.count = snapshot.count
+	s.depth = snapshot.depth
+}
+
 func (s *scope) isEmpty() bool {
 	return s.count == 0
 }
@@ -33,9 +64,24 @@ func (s *scope) addGlobal(identifier string, modifiable bool) {
 	s.globals[identifier] = modifiable
 }
 
-func (s *scope) addLocal(t Token, modifiable bool) error {
+// slot returns the slot of a global variable. Slots are given to undefined
+// variables as well, since they can be defined later, like functions called
+// before being declared, natives or globals of the next lines of the REPL.
+// The operand of the global instructions is a byte, so there are at most size
+// slots: past them the name is left out of the table.
+func (s *scope) slot(id *ast.Ident) (int, error) {
+	if slot, ok := s.symbols.Lookup(id.Name); ok {
+		return slot, nil
+	}
+	if s.symbols.Len() >= size {
+		return 0, errorAt(id.NamePos, "too many global variables, at most %d names can be used as globals", size)
+	}
+	return s.symbols.Slot(id.Name), nil
+}
+
+func (s *scope) addLocal(id *ast.Ident, modifiable bool) error {
 	if s.count >= size {
-		return fmt.Errorf("compile error, too many variables in local scope")
+		return errorAt(id.NamePos, "too many variables in local scope")
 	}
 
 	// check redeclaration
@@ -45,14 +91,14 @@ func (s *scope) addLocal(t Token, modifiable bool) error {
 			break
 		}
 
-		if local.identifier == t.Lexeme {
-			return fmt.Errorf("compile error, variable '%s' is already defined in this scope [line %d]", t.Lexeme, t.Line)
+		if local.identifier == id.Name {
+			return errorAt(id.NamePos, "variable '%s' is already defined in this scope", id.Name)
 		}
 	}
 
 	local := &s.locals[s.count]
 
-	local.identifier = t.Lexeme
+	local.identifier = id.Name
 	local.modifiable = modifiable
 	local.depth = s.depth
 
@@ -0,0 +1,453 @@
+package compiler
+
+import (
+	"fmt"
+	"maki/compiler/ast"
+	"maki/vm"
+	"sort"
+)
+
+// Warning is a likely mistake found by Vet at a position of the source.
+type Warning struct {
+	Line    int
+	Column  int
+	Length  int
+	Message string
+}
+
+func warningAt(p ast.Position, format string, args ...interface{}) *Warning {
+	return &Warning{
+		Line:    p.Line,
+		Column:  p.Column,
+		Length:  p.Length,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Span returns where the warning is in source.
+func (w *Warning) Span() vm.Span {
+	return vm.Span{
+		Line:   w.Line,
+		Column: w.Column,
+		Length: w.Length,
+	}
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("warning, %s [line %d:%d]", w.Message, w.Line, w.Column)
+}
+
+// SymbolKind is the kind of a declaration.
+type SymbolKind uint8
+
+const (
+	Variable SymbolKind = iota
+	Constant
+	Parameter
+	Function
+)
+
+// Symbol is a declaration, as resolved by Resolve.
+type Symbol struct {
+	Ident  *ast.Ident // declared identifier
+	Kind   SymbolKind
+	Global bool
+	Fun    *ast.FunStmt // declaration of a function
+
+	used  bool    // read at least once
+	alias *Symbol // constant whose array is shared by this variable
+}
+
+// vetter walks the syntax tree resolving variables with the scope of the
+// compiler, keeping track of how they are used.
+type vetter struct {
+	globals   map[string]*Symbol
+	refs      map[*ast.Ident]*Symbol // declaration each identifier refers to
+	functions map[string]*ast.FunStmt
+	mutated   map[*ast.FunStmt]map[string]bool // parameters whose elements are assigned
+	scope     *scope
+	symbols   [size]*Symbol // declarations of the locals of scope
+	warnings  []*Warning
+}
+
+// Vet compiles source, returning the compile errors if any, and reports
+// likely mistakes that are not compile errors: unused local variables,
+// shadowed variables, unreachable code, calls with the wrong number of
+// arguments and constant arrays modified through other variables or
+// parameters.
+func Vet(source string) ([]*Warning, error) {
+	if _, err := NewCompiler().Compile(source); err != nil {
+		return nil, err
+	}
+
+	file, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	v := newVetter(file)
+
+	sort.SliceStable(v.warnings, func(i, j int) bool {
+		if v.warnings[i].Line != v.warnings[j].Line {
+			return v.warnings[i].Line < v.warnings[j].Line
+		}
+		return v.warnings[i].Column < v.warnings[j].Column
+	})
+	return v.warnings, nil
+}
+
+func newVetter(file *ast.File) *vetter {
+	v := &vetter{
+		globals:   make(map[string]*Symbol),
+		refs:      make(map[*ast.Ident]*Symbol),
+		functions: make(map[string]*ast.FunStmt),
+		mutated:   make(map[*ast.FunStmt]map[string]bool),
+		scope:     newScope(),
+	}
+	v.declarations(file)
+	v.statements(file.Statements)
+	return v
+}
+
+// Resolve maps the identifiers of file, declarations included, to the
+// declaration they refer to, resolving them like the compiler does. Natives
+// and undeclared globals are left out.
+func Resolve(file *ast.File) map[*ast.Ident]*Symbol {
+	return newVetter(file).refs
+}
+
+// declarations collects globals and functions in advance, since functions
+// can refer to globals declared after them.
+func (v *vetter) declarations(file *ast.File) {
+	for _, s := range file.Statements {
+		if s, ok := s.(*ast.VarStmt); ok {
+			for _, spec := range s.Specs {
+				kind := Variable
+				if !s.Modifiable {
+					kind = Constant
+				}
+				v.globals[spec.Name.Name] = &Symbol{Ident: spec.Name, Kind: kind, Global: true}
+			}
+		}
+	}
+
+	redefined := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		fun, ok := n.(*ast.FunStmt)
+		if !ok {
+			return true
+		}
+
+		// functions are always global
+		name := fun.Name.Name
+		v.globals[name] = &Symbol{Ident: fun.Name, Kind: Function, Global: true, Fun: fun}
+		if _, ok := v.functions[name]; ok {
+			redefined[name] = true
+		}
+		v.functions[name] = fun
+
+		params := make(map[string]bool)
+		for _, p := range fun.Params {
+			params[p.Name] = true
+		}
+		v.mutated[fun] = make(map[string]bool)
+		ast.Inspect(fun.Body, func(n ast.Node) bool {
+			if a, ok := n.(*ast.Assign); ok {
+				if index, ok := a.Target.(*ast.Index); ok {
+					if id := root(index); id != nil && params[id.Name] {
+						v.mutated[fun][id.Name] = true
+					}
+				}
+			}
+			return true
+		})
+		return true
+	})
+
+	// the number of arguments cannot be checked for functions defined twice
+	for name := range redefined {
+		delete(v.functions, name)
+	}
+}
+
+func (v *vetter) warn(p ast.Position, format string, args ...interface{}) {
+	v.warnings = append(v.warnings, warningAt(p, format, args...))
+}
+
+func (v *vetter) begin() {
+	v.scope.begin()
+}
+
+func (v *vetter) end() {
+	v.scope.end(func() {
+		s := v.symbols[v.scope.count-1]
+		if !s.used && s.Kind != Parameter {
+			v.warn(s.Ident.NamePos, "unused variable '%s'", s.Ident.Name)
+		}
+	})
+}
+
+// declare adds a local variable to the innermost scope.
+func (v *vetter) declare(id *ast.Ident, kind SymbolKind) *Symbol {
+	if outer := v.outer(id.Name); outer != nil {
+		v.warn(id.NamePos, "declaration of '%s' shadows declaration at line %d", id.Name, outer.Ident.NamePos.Line)
+	}
+
+	s := &Symbol{Ident: id, Kind: kind}
+	// redeclarations are compile errors, left out when resolving
+	if err := v.scope.addLocal(id, kind != Constant); err == nil {
+		v.symbols[v.scope.count-1] = s
+	}
+	v.refs[id] = s
+	return s
+}
+
+// outer returns the variable named name of the enclosing scopes, globals
+// included, or nil if there is none.
+func (v *vetter) outer(name string) *Symbol {
+	for i := v.scope.count - 1; i >= 0; i-- {
+		local := v.scope.locals[i]
+		if local.depth < v.scope.depth && local.identifier == name {
+			return v.symbols[i]
+		}
+	}
+	return v.globals[name]
+}
+
+// resolve returns the variable named name, or nil if it is not declared.
+func (v *vetter) resolve(name string) (s *Symbol, isLocal bool) {
+	if isLocal, i, _ := v.scope.resolveVar(name); isLocal {
+		return v.symbols[i], true
+	}
+	return v.globals[name], false
+}
+
+// constant returns the constant whose array is shared with the value of e,
+// if any.
+func (v *vetter) constant(e ast.Expr) *Symbol {
+	id, ok := e.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	s, _ := v.resolve(id.Name)
+	switch {
+	case s == nil:
+		return nil
+	case s.Kind == Constant:
+		return s
+	default:
+		return s.alias
+	}
+}
+
+func (v *vetter) statements(ss []ast.Stmt) {
+	returned := false
+	for _, s := range ss {
+		if returned {
+			v.warn(s.Pos(), "unreachable code")
+			returned = false
+		}
+		v.statement(s)
+
+		if _, ok := s.(*ast.ReturnStmt); ok {
+			returned = true
+		}
+	}
+}
+
+func (v *vetter) statement(s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.AssertStmt:
+		v.expression(s.Expr)
+	case *ast.BlockStmt:
+		{
+			v.begin()
+			v.statements(s.Statements)
+			v.end()
+		}
+	case *ast.ExprStmt:
+		v.expression(s.Expr)
+	case *ast.ForStmt:
+		{
+			v.begin()
+			if s.Init != nil {
+				v.statement(s.Init)
+			}
+			v.expression(s.Cond)
+			v.expression(s.Post)
+			v.statement(s.Body)
+			v.end()
+		}
+	case *ast.FunStmt:
+		{
+			v.refs[s.Name] = v.globals[s.Name.Name]
+
+			v.begin()
+			for _, p := range s.Params {
+				v.declare(p, Parameter)
+			}
+			v.statement(s.Body)
+			v.end()
+		}
+	case *ast.IfStmt:
+		{
+			v.expression(s.Cond)
+			v.statement(s.Then)
+			if s.Else != nil {
+				v.statement(s.Else)
+			}
+		}
+	case *ast.PrintStmt:
+		v.expression(s.Expr)
+	case *ast.ReturnStmt:
+		v.expression(s.Result)
+	case *ast.VarStmt:
+		for _, spec := range s.Specs {
+			kind := Variable
+			if !s.Modifiable {
+				kind = Constant
+			}
+
+			var sym *Symbol
+			if v.scope.depth > 0 {
+				sym = v.declare(spec.Name, kind)
+			} else {
+				sym = v.globals[spec.Name.Name]
+				v.refs[spec.Name] = sym
+			}
+			if spec.Value != nil {
+				v.expression(spec.Value)
+				sym.alias = v.constant(spec.Value)
+			}
+		}
+	case *ast.WhileStmt:
+		{
+			v.expression(s.Cond)
+			v.statement(s.Body)
+		}
+	}
+}
+
+func (v *vetter) expression(e ast.Expr) {
+	switch e := e.(type) {
+	case *ast.Array:
+		for _, e := range e.Elements {
+			v.expression(e)
+		}
+	case *ast.Interpolation:
+		for _, e := range e.Parts {
+			v.expression(e)
+		}
+	case *ast.Assign:
+		v.assign(e)
+	case *ast.Binary:
+		{
+			v.expression(e.Left)
+			v.expression(e.Right)
+		}
+	case *ast.Call:
+		v.call(e)
+	case *ast.Conditional:
+		{
+			v.expression(e.Cond)
+			v.expression(e.Then)
+			v.expression(e.Else)
+		}
+	case *ast.Grouping:
+		v.expression(e.Expr)
+	case *ast.Ident:
+		if s, _ := v.resolve(e.Name); s != nil {
+			s.used = true
+			v.refs[e] = s
+		}
+	case *ast.Index:
+		{
+			v.expression(e.Object)
+			v.expression(e.Index)
+		}
+	case *ast.Property:
+		v.expression(e.Object)
+	case *ast.Slice:
+		{
+			v.expression(e.Object)
+			if e.Low != nil {
+				v.expression(e.Low)
+			}
+			if e.High != nil {
+				v.expression(e.High)
+			}
+		}
+	case *ast.Unary:
+		v.expression(e.Operand)
+	}
+}
+
+func (v *vetter) assign(e *ast.Assign) {
+	switch t := e.Target.(type) {
+	case *ast.Ident:
+		{
+			v.expression(e.Value)
+
+			// assignments to undeclared globals are compile errors
+			s, _ := v.resolve(t.Name)
+			if s == nil {
+				return
+			}
+			v.refs[t] = s
+			if e.Op == "=" {
+				s.alias = v.constant(e.Value)
+			} else {
+				s.alias = nil
+			}
+		}
+	case *ast.Index:
+		{
+			v.expression(t)
+			v.expression(e.Value)
+
+			if id := root(t); id != nil {
+				if s, _ := v.resolve(id.Name); s != nil && s.alias != nil {
+					v.warn(id.NamePos, "assignment to element of '%s' modifies constant '%s'", id.Name, s.alias.Ident.Name)
+				}
+			}
+		}
+	}
+}
+
+func (v *vetter) call(e *ast.Call) {
+	v.expression(e.Callee)
+	for _, arg := range e.Args {
+		v.expression(arg)
+	}
+
+	id, ok := e.Callee.(*ast.Ident)
+	if !ok {
+		return
+	}
+	if _, isLocal := v.resolve(id.Name); isLocal {
+		return
+	}
+	fun, ok := v.functions[id.Name]
+	if !ok {
+		return
+	}
+
+	if len(e.Args) != len(fun.Params) {
+		v.warn(id.NamePos, "function '%s' takes %s, called with %d", id.Name, arguments(len(fun.Params)), len(e.Args))
+		return
+	}
+
+	for i, arg := range e.Args {
+		param := fun.Params[i].Name
+		if c := v.constant(arg); c != nil && v.mutated[fun][param] {
+			v.warn(arg.Pos(), "call to '%s' modifies constant '%s' through parameter '%s'", id.Name, c.Ident.Name, param)
+		}
+	}
+}
+
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
@@ -0,0 +1,141 @@
+package compiler
+
+import (
+	"fmt"
+	"maki/compiler/ast"
+	"testing"
+)
+
+func TestVet(t *testing.T) {
+	tcs := []struct {
+		name     string
+		in       string
+		warnings []Warning
+	}{
+		{
+			name: "No Warnings",
+			in:   "var x = 1\nfun f(n) {\n    var y = n + x\n    return y\n}\nprint f(2)\n",
+		},
+		{
+			name: "Unused Local",
+			in:   "{\n    var x = 1\n    let y = 2\n    print y\n}\nfor var i = 0; i < 3; i = i + 1 { var z }\n",
+			warnings: []Warning{
+				{Line: 2, Column: 9, Length: 1, Message: "unused variable 'x'"},
+				{Line: 6, Column: 39, Length: 1, Message: "unused variable 'z'"},
+			},
+		},
+		{
+			name: "Shadowing",
+			in:   "fun f(n) {\n    {\n        var n = 1\n        print n\n    }\n}\n{\n    var x = 1\n    {\n        var x = 2\n        print x\n    }\n    print x\n}\n",
+			warnings: []Warning{
+				{Line: 3, Column: 13, Length: 1, Message: "declaration of 'n' shadows declaration at line 1"},
+				{Line: 10, Column: 13, Length: 1, Message: "declaration of 'x' shadows declaration at line 8"},
+			},
+		},
+		{
+			name: "Shadowing Globals",
+			in:   "var total = 0\nfun add(total, n) {\n    return total + n\n}\nfun f() {\n    let add = 1\n    return add\n}\n",
+			warnings: []Warning{
+				{Line: 2, Column: 9, Length: 5, Message: "declaration of 'total' shadows declaration at line 1"},
+				{Line: 6, Column: 9, Length: 3, Message: "declaration of 'add' shadows declaration at line 2"},
+			},
+		},
+		{
+			name: "Unreachable Code",
+			in:   "fun f(n) {\n    return n\n    print n\n    print 2 * n\n}\n",
+			warnings: []Warning{
+				{Line: 3, Column: 5, Length: 5, Message: "unreachable code"},
+			},
+		},
+		{
+			name: "Wrong Arity",
+			in:   "fun f(a, b) {\n    return a + b\n}\nfun g(a) {\n    return a\n}\nprint f(1)\nprint g(1, 2) + g(3)\n",
+			warnings: []Warning{
+				{Line: 7, Column: 7, Length: 1, Message: "function 'f' takes 2 arguments, called with 1"},
+				{Line: 8, Column: 7, Length: 1, Message: "function 'g' takes 1 argument, called with 2"},
+			},
+		},
+		{
+			name: "Constant Modified Through Arrays",
+			in:   "let primes = [2, 3, 5]\nvar xs = primes\nxs[0] = 1\nfun clear(ys) {\n    ys[0] = nil\n}\nclear(primes)\nclear(xs)\nclear([1])\n",
+			warnings: []Warning{
+				{Line: 3, Column: 1, Length: 2, Message: "assignment to element of 'xs' modifies constant 'primes'"},
+				{Line: 7, Column: 7, Length: 6, Message: "call to 'clear' modifies constant 'primes' through parameter 'ys'"},
+				{Line: 8, Column: 7, Length: 2, Message: "call to 'clear' modifies constant 'primes' through parameter 'ys'"},
+			},
+		},
+		{
+			name: "Reassigned Alias",
+			in:   "let a = [1]\nvar b = a\nb = [2]\nb[0] = 3\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings, err := Vet(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(warnings) != len(tc.warnings) {
+				t.Fatalf("got %d warnings, want %d: %v", len(warnings), len(tc.warnings), warnings)
+			}
+
+			for i := range warnings {
+				if *warnings[i] != tc.warnings[i] {
+					t.Errorf("got %+v, want %+v", *warnings[i], tc.warnings[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVet_Error(t *testing.T) {
+	tcs := []struct {
+		name string
+		in   string
+	}{
+		{name: "Syntax Error", in: "print (1"},
+		{name: "Constant Assignment", in: "let k=[1]\nk[0]=5"},
+		{name: "Undeclared Global", in: "fun f() {\n    total = 0\n}\n"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Vet(tc.in); err == nil {
+				t.Errorf("got nil, want error")
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	source := "let n = 1\nfun f(n) {\n    var x = n\n    return x + g()\n}\nfun g() {\n    return n\n}\nprint f(n)\n"
+	file, err := Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := Resolve(file)
+
+	// declaration line of each identifier, in order
+	var got []int
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if s, ok := refs[id]; ok {
+				got = append(got, s.Ident.NamePos.Line)
+			} else {
+				got = append(got, 0)
+			}
+		}
+		return true
+	})
+
+	want := []int{1, 2, 2, 3, 2, 3, 6, 6, 1, 2, 1}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if s := refs[file.Statements[1].(*ast.FunStmt).Name]; s.Kind != Function || !s.Global {
+		t.Errorf("got %+v, want global function", s)
+	}
+}
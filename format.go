@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"maki/compiler"
+	"os"
+	"strings"
+)
+
+// formatFiles implements `maki fmt [-w] files...`: it prints the formatted
+// files, or writes them back with -w. Files with errors are reported and left
+// untouched.
+func formatFiles(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	write := flags.Bool("w", false, "write result to source file instead of stdout")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		return errors.New("Usage: maki fmt [-w] files...")
+	}
+
+	var failed []string
+	for _, path := range flags.Args() {
+		if err := formatFile(path, *write, stdout); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", path, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+func formatFile(path string, write bool, stdout io.Writer) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	source := string(b)
+	formatted, err := compiler.Format(source)
+	if err != nil {
+		return errors.New(report(err, source))
+	}
+
+	if !write {
+		_, err := io.WriteString(stdout, formatted)
+		return err
+	}
+
+	if formatted == source {
+		return nil
+	}
+	return ioutil.WriteFile(path, []byte(formatted), info.Mode())
+}
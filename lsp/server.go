@@ -0,0 +1,445 @@
+// Package lsp implements a Language Server Protocol server for Maki, giving
+// editors diagnostics, navigation, completion and formatting.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maki/compiler"
+	"maki/compiler/ast"
+	"maki/vm"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// Server speaks LSP over a pair of streams, usually stdin and stdout. Text
+// documents are synchronized as a whole on every change.
+type Server struct {
+	conn      *conn
+	documents map[string]string
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		conn:      newConn(in, out),
+		documents: make(map[string]string),
+	}
+}
+
+// Run serves requests until the exit notification, or the end of input.
+func (s *Server) Run() error {
+	for {
+		m, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		if e, ok := err.(*Error); ok {
+			if err := s.conn.write(&message{ID: &null, Error: e}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if m.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("lsp :: exit without shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.handle(m.Method, m.Params)
+		if m.ID == nil {
+			// notifications have no response
+			continue
+		}
+
+		response := &message{ID: m.ID}
+		if err != nil {
+			e, ok := err.(*Error)
+			if !ok {
+				e = &Error{Code: RequestFailed, Message: err.Error()}
+			}
+			response.Error = e
+		} else if response.Result, err = json.Marshal(result); err != nil {
+			return err
+		}
+		if err := s.conn.write(response); err != nil {
+			return err
+		}
+	}
+}
+
+var null = json.RawMessage("null")
+
+// handle serves a request or a notification. Documents are compiled as the
+// user types them, so a panic of the compiler is logged and reported as an
+// internal error rather than ending the session.
+func (s *Server) handle(method string, params json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("lsp :: panic serving %s: %v\n%s", method, r, debug.Stack())
+			result, err = nil, &Error{Code: InternalError, Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+	return s.dispatch(method, params)
+}
+
+func (s *Server) dispatch(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		return s.initialize()
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		{
+			s.shutdown = true
+			return nil, nil
+		}
+	case "textDocument/didOpen":
+		{
+			var p DidOpenTextDocumentParams
+			if err := unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		{
+			var p DidChangeTextDocumentParams
+			if err := unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			if n := len(p.ContentChanges); n > 0 {
+				return nil, s.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+			}
+			return nil, nil
+		}
+	case "textDocument/didClose":
+		{
+			var p DidCloseTextDocumentParams
+			if err := unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			delete(s.documents, p.TextDocument.URI)
+			return nil, s.publish(p.TextDocument.URI, []Diagnostic{})
+		}
+	case "textDocument/definition":
+		{
+			var p TextDocumentPositionParams
+			if err := unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			return s.definition(p)
+		}
+	case "textDocument/hover":
+		{
+			var p TextDocumentPositionParams
+			if err := unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			return s.hover(p)
+		}
+	case "textDocument/documentSymbol":
+		{
+			var p DocumentSymbolParams
+			if err := unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			return s.symbols(p)
+		}
+	case "textDocument/completion":
+		return completion(), nil
+	case "textDocument/formatting":
+		{
+			var p DocumentFormattingParams
+			if err := unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			return s.format(p)
+		}
+	}
+
+	return nil, &Error{Code: MethodNotFound, Message: fmt.Sprintf("method not found: %s", method)}
+}
+
+func unmarshal(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{Code: InvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize() (interface{}, error) {
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:           1, // full
+			DefinitionProvider:         true,
+			HoverProvider:              true,
+			DocumentSymbolProvider:     true,
+			CompletionProvider:         map[string]interface{}{},
+			DocumentFormattingProvider: true,
+		},
+		ServerInfo: ServerInfo{Name: "maki"},
+	}, nil
+}
+
+// update stores the new text of a document and publishes its diagnostics.
+func (s *Server) update(uri, text string) error {
+	s.documents[uri] = text
+	return s.publish(uri, diagnostics(text))
+}
+
+func (s *Server) publish(uri string, ds []Diagnostic) error {
+	params, err := json.Marshal(PublishDiagnosticsParams{URI: uri, Diagnostics: ds})
+	if err != nil {
+		return err
+	}
+	return s.conn.write(&message{Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+// diagnostics returns the compile errors of text or, if there are none, the
+// warnings of vet.
+func diagnostics(text string) []Diagnostic {
+	ds := []Diagnostic{}
+	ls := newLines(text)
+
+	_, err := compiler.NewCompiler().Compile(text)
+	if errs, ok := err.(compiler.ErrorList); ok {
+		for _, e := range errs {
+			ds = append(ds, Diagnostic{
+				Range:    ls.span(e.Span()),
+				Severity: SeverityError,
+				Source:   "maki",
+				Message:  e.Message,
+			})
+		}
+		return ds
+	}
+
+	warnings, _ := compiler.Vet(text)
+	for _, w := range warnings {
+		ds = append(ds, Diagnostic{
+			Range:    ls.span(w.Span()),
+			Severity: SeverityWarning,
+			Source:   "maki vet",
+			Message:  w.Message,
+		})
+	}
+	return ds
+}
+
+// lookup returns the identifier at position p of a document, and the
+// declaration it refers to.
+func (s *Server) lookup(p TextDocumentPositionParams) (*ast.Ident, *compiler.Symbol) {
+	text, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+
+	// go on with the statements parsed, if there are errors
+	file, _ := compiler.Parse(text)
+
+	line := p.Position.Line + 1
+	column := newLines(text).column(line, p.Position.Character)
+	var found *ast.Ident
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if id.NamePos.Line == line && id.NamePos.Column <= column && column <= id.NamePos.Column+id.NamePos.Length {
+				found = id
+			}
+		}
+		return found == nil
+	})
+	if found == nil {
+		return nil, nil
+	}
+
+	return found, compiler.Resolve(file)[found]
+}
+
+func (s *Server) definition(p TextDocumentPositionParams) (interface{}, error) {
+	_, symbol := s.lookup(p)
+	if symbol == nil {
+		return nil, nil
+	}
+	ls := newLines(s.documents[p.TextDocument.URI])
+	return Location{URI: p.TextDocument.URI, Range: ls.position(symbol.Ident.NamePos)}, nil
+}
+
+func (s *Server) hover(p TextDocumentPositionParams) (interface{}, error) {
+	id, symbol := s.lookup(p)
+	if symbol == nil {
+		return nil, nil
+	}
+
+	var declaration string
+	switch symbol.Kind {
+	case compiler.Variable:
+		declaration = "var " + id.Name
+	case compiler.Constant:
+		declaration = "let " + id.Name
+	case compiler.Parameter:
+		declaration = "(parameter) " + id.Name
+	case compiler.Function:
+		declaration = signature(symbol.Fun)
+	}
+	scope := "local"
+	if symbol.Global {
+		scope = "global"
+	}
+
+	return Hover{
+		Contents: MarkupContent{
+			Kind:  "markdown",
+			Value: fmt.Sprintf("```maki\n%s\n```\n%s, declared at line %d", declaration, scope, symbol.Ident.NamePos.Line),
+		},
+		Range: newLines(s.documents[p.TextDocument.URI]).position(id.NamePos),
+	}, nil
+}
+
+func (s *Server) symbols(p DocumentSymbolParams) (interface{}, error) {
+	text, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	file, _ := compiler.Parse(text)
+	ls := newLines(text)
+
+	symbols := []DocumentSymbol{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if fun, ok := n.(*ast.FunStmt); ok {
+			symbols = append(symbols, DocumentSymbol{
+				Name:           fun.Name.Name,
+				Detail:         signature(fun),
+				Kind:           SymbolFunction,
+				Range:          Range{Start: ls.position(fun.Pos()).Start, End: ls.position(fun.End()).End},
+				SelectionRange: ls.position(fun.Name.NamePos),
+			})
+		}
+		return true
+	})
+	return symbols, nil
+}
+
+// completion returns keywords and natives.
+func completion() []CompletionItem {
+	var items []CompletionItem
+	for _, k := range compiler.Keywords() {
+		items = append(items, CompletionItem{Label: k, Kind: CompletionKeyword})
+	}
+
+	var natives []string
+	for name := range vm.NewVM().Globals() {
+		natives = append(natives, name)
+	}
+	sort.Strings(natives)
+	for _, n := range natives {
+		items = append(items, CompletionItem{Label: n, Kind: CompletionFunction})
+	}
+	return items
+}
+
+func (s *Server) format(p DocumentFormattingParams) (interface{}, error) {
+	text, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+
+	formatted, err := compiler.Format(text)
+	if err != nil {
+		return nil, &Error{Code: RequestFailed, Message: err.Error()}
+	}
+
+	edits := []TextEdit{}
+	if formatted != text {
+		// replace the whole document
+		ls := newLines(text)
+		last := len(ls) - 1
+		end := Position{Line: last, Character: ls.character(last+1, len([]rune(ls[last]))+1)}
+		edits = append(edits, TextEdit{Range: Range{End: end}, NewText: formatted})
+	}
+	return edits, nil
+}
+
+func signature(fun *ast.FunStmt) string {
+	params := make([]string, len(fun.Params))
+	for i, p := range fun.Params {
+		params[i] = p.Name
+	}
+	return fmt.Sprintf("fun %s(%s)", fun.Name.Name, strings.Join(params, ", "))
+}
+
+// lines are the lines of a document. The compiler counts columns in
+// characters while LSP counts them in UTF-16 code units, so that characters
+// out of the Basic Multilingual Plane, like emoji, take two.
+type lines []string
+
+func newLines(text string) lines {
+	return strings.Split(text, "\n")
+}
+
+// character returns the position in UTF-16 code units of column, a column of
+// the compiler, in line. Both line and column start from 1.
+func (ls lines) character(line, column int) int {
+	var runes []rune
+	if line >= 1 && line <= len(ls) {
+		runes = []rune(ls[line-1])
+	}
+
+	character := 0
+	for i := 0; i < column-1; i++ {
+		// past the end of the line, as multi-line tokens go
+		if i < len(runes) && runes[i] >= 0x10000 {
+			character += 2
+		} else {
+			character++
+		}
+	}
+	return character
+}
+
+// column is the inverse of character, a position in the middle of a
+// character is in that character.
+func (ls lines) column(line, character int) int {
+	var runes []rune
+	if line >= 1 && line <= len(ls) {
+		runes = []rune(ls[line-1])
+	}
+
+	column := 1
+	for i, n := 0, 0; n < character; i++ {
+		if i < len(runes) && runes[i] >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+		if n <= character {
+			column++
+		}
+	}
+	return column
+}
+
+// span converts a span of the compiler, whose lines and columns start from 1,
+// to a range.
+func (ls lines) span(s vm.Span) Range {
+	if s.Line == 0 {
+		return Range{}
+	}
+	start := Position{Line: s.Line - 1, Character: ls.character(s.Line, s.Column)}
+	end := Position{Line: s.Line - 1, Character: ls.character(s.Line, s.Column+s.Length)}
+	return Range{Start: start, End: end}
+}
+
+// position converts the position of a token to a range.
+func (ls lines) position(p ast.Position) Range {
+	return ls.span(vm.Span{Line: p.Line, Column: p.Column, Length: p.Length})
+}
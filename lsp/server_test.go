@@ -0,0 +1,345 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// client is a scripted LSP client talking to a server over pipes.
+type client struct {
+	t    *testing.T
+	conn *conn
+	id   int
+	done chan error
+}
+
+func newClient(t *testing.T) *client {
+	requests, requestWriter := io.Pipe()
+	responses, responseWriter := io.Pipe()
+
+	c := &client{t: t, conn: newConn(responses, requestWriter), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(requests, responseWriter).Run()
+		responseWriter.Close()
+	}()
+	return c
+}
+
+// call sends a request and decodes its result into result.
+func (c *client) call(method string, params interface{}, result interface{}) *Error {
+	c.id++
+	id := json.RawMessage(strconv.Itoa(c.id))
+	c.send(&message{ID: &id, Method: method}, params)
+
+	m := c.receive()
+	if m.ID == nil || string(*m.ID) != string(id) {
+		c.t.Fatalf("got response %s, want response %s", m.ID, id)
+	}
+	if m.Error != nil {
+		return m.Error
+	}
+	if err := json.Unmarshal(m.Result, result); err != nil {
+		c.t.Fatal(err)
+	}
+	return nil
+}
+
+// notify sends a notification.
+func (c *client) notify(method string, params interface{}) {
+	c.send(&message{Method: method}, params)
+}
+
+func (c *client) send(m *message, params interface{}) {
+	var err error
+	if m.Params, err = json.Marshal(params); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.conn.write(m); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) receive() *message {
+	m, err := c.conn.read()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return m
+}
+
+// diagnostics reads the diagnostics published by the server.
+func (c *client) diagnostics() []Diagnostic {
+	m := c.receive()
+	if m.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("got %s, want textDocument/publishDiagnostics", m.Method)
+	}
+	var p PublishDiagnosticsParams
+	if err := json.Unmarshal(m.Params, &p); err != nil {
+		c.t.Fatal(err)
+	}
+	return p.Diagnostics
+}
+
+const (
+	uri    = "file:///add.maki"
+	source = `var x = 1
+fun add(a, b) {
+    return a + b
+}
+print add(x, 2)
+`
+)
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func rangeOf(line, start, end int) Range {
+	return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+}
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+
+	var initialized InitializeResult
+	if err := c.call("initialize", map[string]interface{}{}, &initialized); err != nil {
+		t.Fatal(err)
+	}
+	if !initialized.Capabilities.HoverProvider || initialized.ServerInfo.Name != "maki" {
+		t.Errorf("got %+v, want hover and maki", initialized)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "maki", Version: 1, Text: source},
+	})
+	if ds := c.diagnostics(); len(ds) != 0 {
+		t.Errorf("got %v, want no diagnostics", ds)
+	}
+
+	t.Run("Definition", func(t *testing.T) {
+		tcs := []struct {
+			name     string
+			position TextDocumentPositionParams
+			want     Range
+		}{
+			{name: "Global", position: at(4, 10), want: rangeOf(0, 4, 5)},
+			{name: "Function", position: at(4, 7), want: rangeOf(1, 4, 7)},
+			{name: "Parameter", position: at(2, 15), want: rangeOf(1, 11, 12)},
+			{name: "Declaration", position: at(0, 4), want: rangeOf(0, 4, 5)},
+		}
+
+		for _, tc := range tcs {
+			t.Run(tc.name, func(t *testing.T) {
+				var location Location
+				if err := c.call("textDocument/definition", tc.position, &location); err != nil {
+					t.Fatal(err)
+				}
+				if location.URI != uri || location.Range != tc.want {
+					t.Errorf("got %+v, want %+v", location.Range, tc.want)
+				}
+			})
+		}
+	})
+
+	t.Run("Hover", func(t *testing.T) {
+		tcs := []struct {
+			name     string
+			position TextDocumentPositionParams
+			want     string
+		}{
+			{name: "Global", position: at(4, 10), want: "```maki\nvar x\n```\nglobal, declared at line 1"},
+			{name: "Function", position: at(4, 6), want: "```maki\nfun add(a, b)\n```\nglobal, declared at line 2"},
+			{name: "Parameter", position: at(2, 11), want: "```maki\n(parameter) a\n```\nlocal, declared at line 2"},
+		}
+
+		for _, tc := range tcs {
+			t.Run(tc.name, func(t *testing.T) {
+				var hover Hover
+				if err := c.call("textDocument/hover", tc.position, &hover); err != nil {
+					t.Fatal(err)
+				}
+				if hover.Contents.Value != tc.want {
+					t.Errorf("got %q, want %q", hover.Contents.Value, tc.want)
+				}
+			})
+		}
+	})
+
+	t.Run("No Identifier", func(t *testing.T) {
+		var location *Location
+		if err := c.call("textDocument/definition", at(4, 0), &location); err != nil {
+			t.Fatal(err)
+		}
+		if location != nil {
+			t.Errorf("got %+v, want nil", location)
+		}
+	})
+
+	t.Run("Symbols", func(t *testing.T) {
+		var symbols []DocumentSymbol
+		if err := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols); err != nil {
+			t.Fatal(err)
+		}
+		want := []DocumentSymbol{{
+			Name:           "add",
+			Detail:         "fun add(a, b)",
+			Kind:           SymbolFunction,
+			Range:          Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 3, Character: 1}},
+			SelectionRange: rangeOf(1, 4, 7),
+		}}
+		if !reflect.DeepEqual(symbols, want) {
+			t.Errorf("got %+v, want %+v", symbols, want)
+		}
+	})
+
+	t.Run("Completion", func(t *testing.T) {
+		var items []CompletionItem
+		if err := c.call("textDocument/completion", at(0, 0), &items); err != nil {
+			t.Fatal(err)
+		}
+		want := map[CompletionItem]bool{
+			{Label: "while", Kind: CompletionKeyword}:  true,
+			{Label: "clock", Kind: CompletionFunction}: true,
+		}
+		for _, item := range items {
+			delete(want, item)
+		}
+		if len(want) > 0 {
+			t.Errorf("got %v, want %v among them", items, want)
+		}
+	})
+
+	t.Run("Formatting", func(t *testing.T) {
+		c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   TextDocumentIdentifier{URI: uri},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: "print 1+2;\n{ var y = 1 }"}},
+		})
+		want := []Diagnostic{{Range: rangeOf(1, 6, 7), Severity: SeverityWarning, Source: "maki vet", Message: "unused variable 'y'"}}
+		if ds := c.diagnostics(); !reflect.DeepEqual(ds, want) {
+			t.Errorf("got %+v, want %+v", ds, want)
+		}
+
+		var edits []TextEdit
+		if err := c.call("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits); err != nil {
+			t.Fatal(err)
+		}
+		want2 := []TextEdit{{
+			Range:   Range{End: Position{Line: 1, Character: 13}},
+			NewText: "print 1 + 2\n{ var y = 1 }\n",
+		}}
+		if !reflect.DeepEqual(edits, want2) {
+			t.Errorf("got %+v, want %+v", edits, want2)
+		}
+	})
+
+	t.Run("Non-BMP Characters", func(t *testing.T) {
+		// the emoji takes two UTF-16 code units
+		c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   TextDocumentIdentifier{URI: uri},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: "let s = \"\U0001F600\"; { var y = s }"}},
+		})
+		want := []Diagnostic{{Range: rangeOf(0, 20, 21), Severity: SeverityWarning, Source: "maki vet", Message: "unused variable 'y'"}}
+		if ds := c.diagnostics(); !reflect.DeepEqual(ds, want) {
+			t.Errorf("got %+v, want %+v", ds, want)
+		}
+
+		var location Location
+		if err := c.call("textDocument/definition", at(0, 24), &location); err != nil {
+			t.Fatal(err)
+		}
+		if location.Range != rangeOf(0, 4, 5) {
+			t.Errorf("got %+v, want %+v", location.Range, rangeOf(0, 4, 5))
+		}
+
+		var edits []TextEdit
+		if err := c.call("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits); err != nil {
+			t.Fatal(err)
+		}
+		if len(edits) != 1 || edits[0].Range.End != (Position{Line: 0, Character: 27}) {
+			t.Errorf("got %+v, want an edit up to character 27", edits)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   TextDocumentIdentifier{URI: uri},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: "print \"unterminated"}},
+		})
+		ds := c.diagnostics()
+		if len(ds) != 1 || ds[0].Severity != SeverityError || ds[0].Range.Start.Line != 0 {
+			t.Errorf("got %+v, want an error on the first line", ds)
+		}
+
+		var edits []TextEdit
+		err := c.call("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits)
+		if err == nil || err.Code != RequestFailed {
+			t.Errorf("got %v, want code %d", err, RequestFailed)
+		}
+	})
+
+	t.Run("Unknown Method", func(t *testing.T) {
+		var result interface{}
+		err := c.call("textDocument/rename", at(0, 0), &result)
+		if err == nil || err.Code != MethodNotFound {
+			t.Errorf("got %v, want code %d", err, MethodNotFound)
+		}
+	})
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if ds := c.diagnostics(); len(ds) != 0 {
+		t.Errorf("got %v, want no diagnostics", ds)
+	}
+
+	var result interface{}
+	if err := c.call("shutdown", nil, &result); err != nil {
+		t.Fatal(err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func TestServer_Unbalanced(t *testing.T) {
+	c := newClient(t)
+
+	// a document the compiler once crashed on must not end the session
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "maki", Version: 1, Text: "}"},
+	})
+	if ds := c.diagnostics(); len(ds) != 1 || ds[0].Message != "unexpected '}'" {
+		t.Errorf("got %+v, want unexpected '}'", ds)
+	}
+
+	var symbols []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols); err != nil {
+		t.Fatal(err)
+	}
+	if len(symbols) != 0 {
+		t.Errorf("got %+v, want no symbols", symbols)
+	}
+
+	var result interface{}
+	if err := c.call("shutdown", nil, &result); err != nil {
+		t.Fatal(err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func TestServer_ExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err == nil {
+		t.Error("got nil, want error")
+	}
+}
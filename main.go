@@ -1,26 +1,50 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"maki/compiler"
+	"maki/lsp"
 	"maki/vm"
 	"os"
 )
 
-var debug bool
+var (
+	debug    bool
+	optimize bool
+)
 
 func main() {
 	flag.BoolVar(&debug, "debug", false, "debug mode")
+	flag.BoolVar(&optimize, "O", false, "optimize compiled code")
 	flag.Parse()
 
 	args := flag.Args()
 
 	if len(args) == 0 {
-		if err := repl(); err != nil {
+		if err := repl(os.Stdin, os.Stdout, os.Stderr); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	} else if args[0] == "fmt" {
+		if err := formatFiles(args[1:], os.Stdout); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	} else if args[0] == "vet" {
+		if err := vetFiles(args[1:]); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	} else if args[0] == "bench" {
+		if err := benchFiles(args[1:], os.Stdout); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	} else if args[0] == "lsp" {
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
 			_, _ = fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
@@ -30,35 +54,11 @@ func main() {
 			os.Exit(1)
 		}
 	} else {
-		_, _ = fmt.Fprintf(os.Stderr, "Usage: maki [path]\n")
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: maki [-O] [path]\n       maki fmt [-w] files...\n       maki vet files...\n       maki bench [-time d] files...\n       maki lsp\n")
 		os.Exit(64)
 	}
 }
 
-func repl() error {
-	r := bufio.NewReader(os.Stdin)
-
-	replCompiler := compiler.NewCompiler()
-	replVM := vm.NewVM()
-
-	for {
-		fmt.Print("> ")
-		line, err := r.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		if err := interpret(replCompiler, replVM, line); err != nil {
-			fmt.Println("maki ::", err)
-		}
-	}
-
-	return nil
-}
-
 func runFile(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
@@ -75,7 +75,10 @@ func runFile(path string) error {
 		return err
 	}
 
-	return interpret(compiler.NewCompiler(), vm.NewVM(), string(b))
+	if err := interpret(compiler.NewCompiler(compiler.Optimize(optimize)), vm.NewVM(), string(b)); err != nil {
+		return errors.New(report(err, string(b)))
+	}
+	return nil
 }
 
 func interpret(c *compiler.Compiler, vm *vm.VM, source string) error {
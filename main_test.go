@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"maki/compiler"
+	"maki/vm"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var expectRegexp = regexp.MustCompile(`(?m)^.*expect: (.*)$`)
+
+// TestSuite runs every program in the test directory and checks its output
+// against the `expect:` comments, like test/run_all.sh does with the binary.
+func TestSuite(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("test", "*", "*.maki"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var expect strings.Builder
+			for _, m := range expectRegexp.FindAllStringSubmatch(string(b), -1) {
+				expect.WriteString(m[1] + "\n")
+			}
+
+			// optimized code must behave the same
+			for _, optimize := range []bool{false, true} {
+				var stdout bytes.Buffer
+				machine := vm.NewVM(vm.Stdout(&stdout))
+				if err := interpret(compiler.NewCompiler(compiler.Optimize(optimize)), machine, string(b)); err != nil {
+					t.Fatalf("optimize %t: got %v, want nil", optimize, err.Error())
+				}
+
+				if stdout.String() != expect.String() {
+					t.Errorf("optimize %t: got:\n%s\nwant:\n%s", optimize, stdout.String(), expect.String())
+				}
+			}
+		})
+	}
+}
+
+func TestREPL(t *testing.T) {
+	tcs := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			name:   "Single Line",
+			input:  "print 1 + 2\n",
+			output: "> 3\n> ",
+		},
+		{
+			name:   "Multi-line Function",
+			input:  "fun double(n) {\n    return n * 2\n}\nprint double(21)\n",
+			output: "> . . > 42\n> ",
+		},
+		{
+			name:   "Multi-line String",
+			input:  "print \"Hello,\nMaki!\"\n",
+			output: "> . Hello,\nMaki!\n> ",
+		},
+		{
+			name:   "Multi-line If",
+			input:  "if false {\n    print 1\n} else {\n    print 2\n}\n",
+			output: "> . . . . 2\n> ",
+		},
+		{
+			name:   "Multi-line Comment",
+			input:  "/* first\nsecond */ print 42\n",
+			output: "> . 42\n> ",
+		},
+		{
+			name:   "Late Binding",
+			input:  "fun f() {\n    return g()\n}\nfun g() {\n    return 42\n}\nprint f()\n",
+			output: "> . . > . . > 42\n> ",
+		},
+		{
+			name:   "Defined After Use",
+			input:  "print x\nvar x = 1\nprint x + 1\n",
+			output: "> maki :: runtime error, variable 'x' not defined [line 1:7]\n   1 | print x\n     |       ^\n> > 2\n> ",
+		},
+		{
+			name:   "Declared After Error",
+			input:  "print ); var z = 1\nvar z = 2\nprint z\n",
+			output: "> compile error, expected expression after 'print' [line 1:7]\n   1 | print ); var z = 1\n     |       ^\n> > 2\n> ",
+		},
+		{
+			name:   "Native",
+			input:  "print clock() > 0\n",
+			output: "> true\n> ",
+		},
+		{
+			name:   "Incomplete At EOF",
+			input:  "fun f() {\n",
+			output: "> . compile error, expected '}' [line 2:1]\n   2 | \n     | ^\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := repl(strings.NewReader(tc.input), &stdout, &stderr); err != nil {
+				t.Fatalf("got %v, want nil", err.Error())
+			}
+
+			if stdout.String() != tc.output {
+				t.Errorf("got %q, want %q", stdout.String(), tc.output)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	tcs := []struct {
+		name   string
+		in     string
+		output string
+	}{
+		{
+			name:   "Compile Errors",
+			in:     "print (1 + 2\nvar x = \"Maki\" $\n",
+			output: "compile error, expected ')' [line 1:13]\n   1 | print (1 + 2\n     |             ^\ncompile error, unknown character '$' [line 2:16]\n   2 | var x = \"Maki\" $\n     |                ^",
+		},
+		{
+			name:   "Token Span",
+			in:     "let answer = 42\nanswer = 0\n",
+			output: "compile error, cannot assign expression to constant 'answer' [line 2:1]\n   2 | answer = 0\n     | ^~~~~~",
+		},
+		{
+			name:   "Runtime Error",
+			in:     "print 1 +  \"Maki\"\n",
+			output: "maki :: runtime error, invalid binary operands [line 1:9]\n   1 | print 1 +  \"Maki\"\n     |         ^",
+		},
+		{
+			name:   "Runtime Error In Function",
+			in:     "fun f(a) {\n\treturn a * unknown\n}\n\nprint f(1)\n",
+			output: "maki :: runtime error, variable 'unknown' not defined [line 2:13]\n   2 | \treturn a * unknown\n     | \t           ^~~~~~~",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := interpret(compiler.NewCompiler(), vm.NewVM(vm.Stdout(ioutil.Discard)), tc.in)
+			if err == nil {
+				t.Fatalf("got nil, want error")
+			}
+
+			if got := report(err, tc.in); got != tc.output {
+				t.Errorf("got %q, want %q", got, tc.output)
+			}
+		})
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := newSession(strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+	if err := interpret(s.compiler, s.vm, "var printer = 1\n"); err != nil {
+		t.Fatalf("got %v, want nil", err.Error())
+	}
+
+	tcs := []struct {
+		name   string
+		word   string
+		output []string
+	}{
+		{
+			name:   "Keywords And Globals",
+			word:   "pri",
+			output: []string{"print", "printer", "println"},
+		},
+		{
+			name:   "Natives",
+			word:   "cl",
+			output: []string{"class", "clock"},
+		},
+		{
+			name:   "No Match",
+			word:   "xyz",
+			output: []string{},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := s.complete(tc.word)
+			sort.Strings(got)
+
+			if strings.Join(got, " ") != strings.Join(tc.output, " ") {
+				t.Errorf("got %v, want %v", got, tc.output)
+			}
+		})
+	}
+}
+
+func TestREPL_Echo(t *testing.T) {
+	tcs := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			name:   "Number",
+			input:  "1 + 2\n",
+			output: "3\n",
+		},
+		{
+			name:   "String",
+			input:  "\"Hello, \" + \"Maki!\"\n",
+			output: "\"Hello, Maki!\"\n",
+		},
+		{
+			name:   "Array",
+			input:  "[ 1, \"two\", nil ]\n",
+			output: "[ 1, two, nil ]\n",
+		},
+		{
+			name:   "Variable",
+			input:  "var x = 41\nx = x + 1\nx\n",
+			output: "42\n42\n",
+		},
+		{
+			name:   "Nil Is Not Displayed",
+			input:  "var x\nx\nnil\n",
+			output: "",
+		},
+		{
+			name:   "Only Last Statement",
+			input:  "1; 2; 3\n",
+			output: "3\n",
+		},
+		{
+			name:   "Statements Are Not Displayed",
+			input:  "print 42\nvar x = 1\n{ x + 1 }\nwhile x < 3 x = x + 1\nx\n",
+			output: "42\n3\n",
+		},
+		{
+			name:   "Function Call",
+			input:  "fun f() {\n    return true\n}\nf()\n",
+			output: "true\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := repl(strings.NewReader(tc.input), &stdout, ioutil.Discard); err != nil {
+				t.Fatalf("got %v, want nil", err.Error())
+			}
+
+			output := strings.NewReplacer(prompt, "", continuationPrompt, "").Replace(stdout.String())
+			if output != tc.output {
+				t.Errorf("got %q, want %q", output, tc.output)
+			}
+		})
+	}
+}
+
+func TestREPL_Commands(t *testing.T) {
+	tcs := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			name:   "Dis Function",
+			input:  "fun f() {\n    return 1\n}\n:dis f\n",
+			output: "__f__\n0000   2 OP_VALUE '1'\n0002   | OP_RETURN\n0003   3 OP_VALUE 'nil'\n0005   | OP_RETURN\n",
+		},
+		{
+			name:   "Dis Expression",
+			input:  ":dis 1 + 2\n",
+			output: "__MAIN__\n0000   1 OP_VALUE '1'\n0002   | OP_VALUE '2'\n0004   | OP_ADD\n0005   | OP_TERMINATE\n",
+		},
+		{
+			name:   "Globals",
+			input:  "var {\n    n = 42\n    s = \"Maki\"\n}\n:globals\n",
+			output: "bigint :: native = <native fun>\nclock :: native = <native fun>\ncopy :: native = <native fun>\ndecimal :: native = <native fun>\nlen :: native = <native fun>\nn :: int = 42\nprintln :: native = <native fun>\nreadln :: native = <native fun>\ns :: string = Maki\n",
+		},
+		{
+			name:   "Type",
+			input:  "var a = [ 1, 2 ]\n:type a\n:type 1 + 2\n:type \"Maki\"\n:type a[0] == 1\n:type clock\n",
+			output: "array\nint\nstring\nbool\nnative\n",
+		},
+		{
+			name:   "Reset",
+			input:  "var x = 1\n:reset\nprint x\n",
+			output: "maki :: runtime error, variable 'x' not defined [line 1:7]\n   1 | print x\n     |       ^\n",
+		},
+		{
+			name:   "Load",
+			input:  ":load test/function/function.maki\nprint fib(10)\n",
+			output: "Hello, Maki!\nHello, Maki!\n3\n5\n8\n15\n3\n2\n1\nBang!\n123\n1\n1\n2\n3\n5\nlocal function\n89\n",
+		},
+		{
+			name:   "Unknown Command",
+			input:  ":foo\n",
+			output: "maki :: unknown command ':foo', type :help for a list of commands\n",
+		},
+		{
+			name:   "Missing Argument",
+			input:  ":type\n",
+			output: "maki :: usage :type <expr>\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := repl(strings.NewReader(tc.input), &stdout, ioutil.Discard); err != nil {
+				t.Fatalf("got %v, want nil", err.Error())
+			}
+
+			// prompts are not relevant here
+			output := strings.NewReplacer(prompt, "", continuationPrompt, "").Replace(stdout.String())
+			if output != tc.output {
+				t.Errorf("got %q, want %q", output, tc.output)
+			}
+		})
+	}
+}
+
+func TestREPL_Time(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := repl(strings.NewReader(":time print 42\n"), &stdout, ioutil.Discard); err != nil {
+		t.Fatalf("got %v, want nil", err.Error())
+	}
+
+	if !regexp.MustCompile(`^> 42\ntime :: \S+\n> $`).MatchString(stdout.String()) {
+		t.Errorf("got %q, want time elapsed", stdout.String())
+	}
+}
+
+func TestFormatFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "program.maki")
+	if err := ioutil.WriteFile(path, []byte("var {a=1}\nif a==1 {\nprint a\n}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := "var {\n    a = 1\n}\nif a == 1 {\n    print a\n}\n"
+
+	var stdout bytes.Buffer
+	if err := formatFiles([]string{path}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != want {
+		t.Errorf("got %q, want %q", stdout.String(), want)
+	}
+
+	stdout.Reset()
+	if err := formatFiles([]string{"-w", path}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("got %q, want empty output", stdout.String())
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != want {
+		t.Errorf("got %q, want %q", b, want)
+	}
+
+	invalid := filepath.Join(dir, "invalid.maki")
+	if err := ioutil.WriteFile(invalid, []byte("print @\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = formatFiles([]string{"-w", invalid, path}, &stdout)
+	if err == nil {
+		t.Fatal("got nil, want error")
+	}
+	if !strings.HasPrefix(err.Error(), invalid+": compile error, unknown character '@'") {
+		t.Errorf("got %q, want error for %s", err, invalid)
+	}
+	if b, _ := ioutil.ReadFile(invalid); string(b) != "print @\n" {
+		t.Errorf("got %q, want file untouched", b)
+	}
+}
+
+func TestVetFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clean := filepath.Join(dir, "clean.maki")
+	if err := ioutil.WriteFile(clean, []byte("var x = 1\nprint x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := vetFiles([]string{clean}); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+
+	path := filepath.Join(dir, "program.maki")
+	if err := ioutil.WriteFile(path, []byte("{\n    var unused = 1\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = vetFiles([]string{clean, path})
+	if err == nil {
+		t.Fatal("got nil, want error")
+	}
+	want := path + ": warning, unused variable 'unused' [line 2:9]\n   2 |     var unused = 1\n     |         ^~~~~~"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	source, err := ioutil.ReadFile(filepath.Join("example", "fib.maki"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	fun, err := compiler.NewCompiler().Compile(string(source))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := vm.NewVM(vm.Stdout(ioutil.Discard)).Run(fun); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBenchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "program.maki")
+	source := "print \"discarded\"\nfun bench_sum() {\n    return 1 + 2\n}\nfun bench_arg(n) {\n    return n\n}\nfun helper() {\n}\n"
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := benchFiles([]string{"-time", "1ms", path}, &stdout); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !regexp.MustCompile(`^bench_sum +\d+ +\d+ ns/op\n$`).MatchString(stdout.String()) {
+		t.Errorf("got %q, want a line for bench_sum", stdout.String())
+	}
+
+	empty := filepath.Join(dir, "empty.maki")
+	if err := ioutil.WriteFile(empty, []byte("print 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = benchFiles([]string{empty}, ioutil.Discard)
+	if want := empty + ": no bench_ functions found"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+
+	failing := filepath.Join(dir, "failing.maki")
+	if err := ioutil.WriteFile(failing, []byte("fun bench_fail() {\n    return 1 + nil\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = benchFiles([]string{failing}, ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "invalid binary operands [line 2:14]") {
+		t.Errorf("got %v, want runtime error", err)
+	}
+}
+
+// BenchmarkSuite runs the bench_ functions of the programs in the bench
+// directory, as `maki bench` does.
+func BenchmarkSuite(b *testing.B) {
+	files, err := filepath.Glob(filepath.Join("bench", "*.maki"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		bs, err := benchmarks(string(source))
+		if err != nil {
+			b.Fatal(report(err, string(source)))
+		}
+
+		for _, bench := range bs {
+			b.Run(strings.TrimSuffix(filepath.Base(file), ".maki")+"/"+bench.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := bench.run(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,402 @@
+// Package readline implements a minimal line editor for the REPL, with
+// cursor movement, history and tab completion. When the input is not a
+// terminal lines are read as they are, without any editing.
+package readline
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupt is returned by Readline when the user presses Ctrl-C.
+var ErrInterrupt = errors.New("interrupt")
+
+// HistorySize is the maximum number of lines kept in history.
+const HistorySize = 1000
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyTab       = 9
+	keyEnter     = 13
+	keyNewLine   = 10
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+// Completer returns the candidates for completing word, that is the
+// identifier under the cursor.
+type Completer func(word string) []string
+
+type Editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       uintptr
+	terminal bool
+
+	history []string
+	// Complete is used for tab completion, if nil tab is ignored.
+	Complete Completer
+
+	// line under editing
+	line []rune
+	pos  int
+}
+
+// NewEditor returns an editor reading from in and writing to out. Line editing
+// is enabled only if in is a terminal.
+func NewEditor(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+
+	if f, ok := in.(*os.File); ok && isTerminal(f.Fd()) {
+		e.fd = f.Fd()
+		e.terminal = true
+	}
+
+	return e
+}
+
+// IsTerminal reports whether line editing is enabled.
+func (e *Editor) IsTerminal() bool {
+	return e.terminal
+}
+
+// Read implements io.Reader, so that the editor input can be shared with
+// whoever needs to read raw input between two lines.
+func (e *Editor) Read(p []byte) (int, error) {
+	return e.in.Read(p)
+}
+
+// Readline prints prompt and returns the next line without the trailing
+// newline. It returns io.EOF when the input ends or the user presses Ctrl-D
+// on an empty line.
+func (e *Editor) Readline(prompt string) (string, error) {
+	if !e.terminal {
+		return e.readPlain(prompt)
+	}
+
+	s, err := makeRaw(e.fd)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer func() {
+		_ = restore(e.fd, s)
+	}()
+
+	return e.edit(prompt)
+}
+
+func (e *Editor) readPlain(prompt string) (string, error) {
+	_, _ = fmt.Fprint(e.out, prompt)
+
+	line, err := e.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// AddHistory appends line to history, ignoring empty lines and duplicates of
+// the last one.
+func (e *Editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > HistorySize {
+		e.history = e.history[len(e.history)-HistorySize:]
+	}
+}
+
+// LoadHistory appends to history the lines read from r.
+func (e *Editor) LoadHistory(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		e.AddHistory(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// SaveHistory writes history to w, one line each.
+func (e *Editor) SaveHistory(w io.Writer) error {
+	for _, line := range e.history {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// edit reads keys until enter is pressed, keeping the line on screen updated.
+func (e *Editor) edit(prompt string) (string, error) {
+	e.line = e.line[:0]
+	e.pos = 0
+
+	// history index, len(e.history) is the line under editing
+	index := len(e.history)
+	edited := ""
+
+	e.refresh(prompt)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyNewLine:
+			{
+				_, _ = fmt.Fprint(e.out, "\r\n")
+				return string(e.line), nil
+			}
+		case keyCtrlC:
+			{
+				_, _ = fmt.Fprint(e.out, "^C\r\n")
+				return "", ErrInterrupt
+			}
+		case keyCtrlD:
+			{
+				if len(e.line) == 0 {
+					_, _ = fmt.Fprint(e.out, "\r\n")
+					return "", io.EOF
+				}
+				e.delete()
+			}
+		case keyBackspace, keyCtrlH:
+			{
+				if e.pos > 0 {
+					e.pos--
+					e.delete()
+				}
+			}
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.line)
+		case keyCtrlB:
+			e.left()
+		case keyCtrlF:
+			e.right()
+		case keyCtrlK:
+			e.line = e.line[:e.pos]
+		case keyCtrlU:
+			{
+				e.line = append(e.line[:0], e.line[e.pos:]...)
+				e.pos = 0
+			}
+		case keyCtrlW:
+			e.deleteWord()
+		case keyCtrlL:
+			_, _ = fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP:
+			index, edited = e.browse(index, index-1, edited)
+		case keyCtrlN:
+			index, edited = e.browse(index, index+1, edited)
+		case keyTab:
+			e.complete(prompt)
+		case keyEscape:
+			{
+				switch e.readEscape() {
+				case 'A':
+					index, edited = e.browse(index, index-1, edited)
+				case 'B':
+					index, edited = e.browse(index, index+1, edited)
+				case 'C':
+					e.right()
+				case 'D':
+					e.left()
+				case 'H':
+					e.pos = 0
+				case 'F':
+					e.pos = len(e.line)
+				case '3':
+					e.delete()
+				}
+			}
+		default:
+			{
+				if unicode.IsPrint(r) {
+					e.insert(r)
+				}
+			}
+		}
+
+		e.refresh(prompt)
+	}
+}
+
+// readEscape consumes an escape sequence, returning its final character
+// for arrows (A-D), home (H), end (F) and '3' for delete.
+func (e *Editor) readEscape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+
+	switch r {
+	case '1', '7':
+		{
+			// home as "ESC [ 1 ~" or "ESC [ 7 ~"
+			_, _, _ = e.in.ReadRune()
+			return 'H'
+		}
+	case '4', '8':
+		{
+			// end as "ESC [ 4 ~" or "ESC [ 8 ~"
+			_, _, _ = e.in.ReadRune()
+			return 'F'
+		}
+	case '3':
+		{
+			// delete as "ESC [ 3 ~"
+			_, _, _ = e.in.ReadRune()
+			return '3'
+		}
+	}
+	return r
+}
+
+func (e *Editor) insert(r rune) {
+	e.line = append(e.line, 0)
+	copy(e.line[e.pos+1:], e.line[e.pos:])
+	e.line[e.pos] = r
+	e.pos++
+}
+
+func (e *Editor) delete() {
+	if e.pos < len(e.line) {
+		e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+	}
+}
+
+func (e *Editor) deleteWord() {
+	start := e.pos
+	for start > 0 && unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+	e.line = append(e.line[:start], e.line[e.pos:]...)
+	e.pos = start
+}
+
+func (e *Editor) left() {
+	if e.pos > 0 {
+		e.pos--
+	}
+}
+
+func (e *Editor) right() {
+	if e.pos < len(e.line) {
+		e.pos++
+	}
+}
+
+// browse moves from history entry index to next, saving the line under
+// editing when leaving it.
+func (e *Editor) browse(index, next int, edited string) (int, string) {
+	if next < 0 || next > len(e.history) {
+		return index, edited
+	}
+
+	if index == len(e.history) {
+		edited = string(e.line)
+	}
+
+	if next == len(e.history) {
+		e.line = []rune(edited)
+	} else {
+		e.line = []rune(e.history[next])
+	}
+	e.pos = len(e.line)
+
+	return next, edited
+}
+
+// complete replaces the word before the cursor with the common prefix of
+// the candidates, listing them when there is nothing left to complete.
+func (e *Editor) complete(prompt string) {
+	if e.Complete == nil {
+		return
+	}
+
+	start := e.pos
+	for start > 0 && isWord(e.line[start-1]) {
+		start--
+	}
+	word := string(e.line[start:e.pos])
+
+	candidates := e.Complete(word)
+	if len(candidates) == 0 {
+		return
+	}
+	sort.Strings(candidates)
+
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		prefix += " "
+	}
+
+	if prefix != word && strings.HasPrefix(prefix, word) {
+		tail := append([]rune(prefix), e.line[e.pos:]...)
+		e.line = append(e.line[:start], tail...)
+		e.pos = start + len([]rune(prefix))
+		return
+	}
+
+	_, _ = fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+}
+
+// refresh redraws prompt and line, placing the cursor at its position.
+func (e *Editor) refresh(prompt string) {
+	_, _ = fmt.Fprintf(e.out, "\r%s%s\x1b[K\r", prompt, string(e.line))
+
+	if column := len([]rune(prompt)) + e.pos; column > 0 {
+		_, _ = fmt.Fprintf(e.out, "\x1b[%dC", column)
+	}
+}
+
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func commonPrefix(ss []string) string {
+	prefix := ss[0]
+	for _, s := range ss[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,209 @@
+package readline
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func newTestEditor(input string) *Editor {
+	return &Editor{
+		in:       bufio.NewReader(strings.NewReader(input)),
+		out:      ioutil.Discard,
+		terminal: true,
+	}
+}
+
+func TestEditor_Edit(t *testing.T) {
+	tcs := []struct {
+		name    string
+		history []string
+		input   string
+		output  []string
+	}{
+		{
+			name:   "Happy Path",
+			input:  "print 42\r",
+			output: []string{"print 42"},
+		},
+		{
+			name:   "Backspace",
+			input:  "prinn\x7ft\r",
+			output: []string{"print"},
+		},
+		{
+			name:   "Arrow Keys",
+			input:  "ac\x1b[Db\x1b[C!\r",
+			output: []string{"abc!"},
+		},
+		{
+			name:   "Home And End",
+			input:  "bc\x01a\x05d\r",
+			output: []string{"abcd"},
+		},
+		{
+			name:   "Kill Line",
+			input:  "print 42\x01\x0bprint 0\r",
+			output: []string{"print 0"},
+		},
+		{
+			name:   "Delete Word",
+			input:  "print 42\x17\x17var\r",
+			output: []string{"var"},
+		},
+		{
+			name:    "History",
+			history: []string{"var x = 1", "print x"},
+			input:   "\x1b[A\x1b[A\r\x1b[A\x1b[B\r",
+			output:  []string{"var x = 1", ""},
+		},
+		{
+			name:    "History Keeps Edited Line",
+			history: []string{"print x"},
+			input:   "print y\x1b[A\x1b[B\r",
+			output:  []string{"print y"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newTestEditor(tc.input)
+			for _, h := range tc.history {
+				e.AddHistory(h)
+			}
+
+			for _, want := range tc.output {
+				got, err := e.edit("> ")
+				if err != nil {
+					t.Fatalf("got %v, want nil", err.Error())
+				}
+				if got != want {
+					t.Errorf("got %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEditor_Keys(t *testing.T) {
+	tcs := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{
+			name:  "Ctrl-D",
+			input: "\x04",
+			err:   io.EOF,
+		},
+		{
+			name:  "Ctrl-C",
+			input: "print\x03",
+			err:   ErrInterrupt,
+		},
+		{
+			name:  "End Of Input",
+			input: "print",
+			err:   io.EOF,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := newTestEditor(tc.input).edit("> "); err != tc.err {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestEditor_Complete(t *testing.T) {
+	candidates := []string{"print", "println", "var", "while"}
+	complete := func(word string) []string {
+		var matches []string
+		for _, c := range candidates {
+			if strings.HasPrefix(c, word) {
+				matches = append(matches, c)
+			}
+		}
+		return matches
+	}
+
+	tcs := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			name:   "Single Candidate",
+			input:  "wh\t\r",
+			output: "while ",
+		},
+		{
+			name:   "Common Prefix",
+			input:  "p\t\r",
+			output: "print",
+		},
+		{
+			name:   "Word Before Cursor",
+			input:  "x = va\t\r",
+			output: "x = var ",
+		},
+		{
+			name:   "No Candidates",
+			input:  "foo\t\r",
+			output: "foo",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newTestEditor(tc.input)
+			e.Complete = complete
+
+			got, err := e.edit("> ")
+			if err != nil {
+				t.Fatalf("got %v, want nil", err.Error())
+			}
+			if got != tc.output {
+				t.Errorf("got %q, want %q", got, tc.output)
+			}
+		})
+	}
+}
+
+func TestEditor_History(t *testing.T) {
+	e := newTestEditor("")
+	if err := e.LoadHistory(strings.NewReader("print 1\nprint 1\n\nprint 2\n")); err != nil {
+		t.Fatalf("got %v, want nil", err.Error())
+	}
+
+	var b strings.Builder
+	if err := e.SaveHistory(&b); err != nil {
+		t.Fatalf("got %v, want nil", err.Error())
+	}
+
+	if want := "print 1\nprint 2\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestEditor_Plain(t *testing.T) {
+	e := NewEditor(strings.NewReader("print 1\r\nprint 2"), ioutil.Discard)
+
+	for _, want := range []string{"print 1", "print 2"} {
+		got, err := e.Readline("> ")
+		if err != nil {
+			t.Fatalf("got %v, want nil", err.Error())
+		}
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	if _, err := e.Readline("> "); err != io.EOF {
+		t.Errorf("got %v, want EOF", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package readline
+
+import "errors"
+
+type state struct{}
+
+func isTerminal(_ uintptr) bool {
+	return false
+}
+
+func makeRaw(_ uintptr) (*state, error) {
+	return nil, errors.New("raw mode not supported")
+}
+
+func restore(_ uintptr, _ *state) error {
+	return nil
+}
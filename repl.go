@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"maki/compiler"
+	"maki/readline"
+	"maki/vm"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = ". "
+)
+
+// session holds the state of a REPL, that is reset by the :reset command.
+type session struct {
+	compiler *compiler.Compiler
+	vm       *vm.VM
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+func newSession(stdin io.Reader, stdout, stderr io.Writer) *session {
+	s := &session{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	s.reset()
+	return s
+}
+
+func (s *session) reset() {
+	s.compiler = compiler.NewInteractiveCompiler(compiler.Optimize(optimize))
+	s.vm = vm.NewVM(vm.Stdin(s.stdin), vm.Stdout(s.stdout), vm.Stderr(s.stderr))
+}
+
+func repl(stdin io.Reader, stdout, stderr io.Writer) error {
+	editor := readline.NewEditor(stdin, stdout)
+	s := newSession(editor, stdout, stderr)
+
+	editor.Complete = s.complete
+
+	// history is persisted only for interactive sessions
+	if editor.IsTerminal() {
+		loadHistory(editor)
+		defer saveHistory(editor)
+	}
+
+	// source collects lines until the statement is complete
+	var source strings.Builder
+
+	for {
+		p := prompt
+		if source.Len() > 0 {
+			p = continuationPrompt
+		}
+
+		line, err := editor.Readline(p)
+		if err == readline.ErrInterrupt {
+			source.Reset()
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if err == nil {
+			editor.AddHistory(line)
+
+			if source.Len() == 0 && strings.HasPrefix(line, ":") {
+				s.command(line)
+				continue
+			}
+
+			source.WriteString(line + "\n")
+
+			if !compiler.IsComplete(source.String()) {
+				continue
+			}
+		}
+
+		if strings.TrimSpace(source.String()) != "" {
+			if err := s.eval(source.String()); err != nil {
+				s.report(err, source.String())
+			}
+		}
+		source.Reset()
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return nil
+}
+
+// eval runs source displaying the value of the last expression statement,
+// unless it is nil.
+func (s *session) eval(source string) error {
+	fun, err := s.compiler.Compile(source)
+	if err != nil {
+		return err
+	}
+
+	if debug {
+		_, _ = fmt.Fprint(s.stdout, fun)
+	}
+
+	v, err := s.vm.Eval(fun)
+	if err != nil {
+		return err
+	}
+
+	switch v.TypeName() {
+	case "nil":
+		break
+	case "string":
+		_, _ = fmt.Fprintln(s.stdout, strconv.Quote(v.String()))
+	default:
+		_, _ = fmt.Fprintln(s.stdout, v)
+	}
+	return nil
+}
+
+type command struct {
+	usage       string
+	description string
+	run         func(s *session, arg string) error
+}
+
+var commands map[string]command
+
+func init() {
+	// initialized here since :help refers to commands itself
+	commands = map[string]command{
+		"dis":     {usage: ":dis <expr|fun>", description: "print the pcode of a function or an expression", run: (*session).dis},
+		"globals": {usage: ":globals", description: "list global variables with their type", run: (*session).globals},
+		"help":    {usage: ":help", description: "list available commands", run: (*session).help},
+		"load":    {usage: ":load <file>", description: "run a file into the current session", run: (*session).load},
+		"reset":   {usage: ":reset", description: "discard all definitions and start over", run: (*session).clear},
+		"time":    {usage: ":time <code>", description: "run code and print the time elapsed", run: (*session).time},
+		"type":    {usage: ":type <expr>", description: "print the type of an expression", run: (*session).typeOf},
+	}
+}
+
+// report prints err, with the snippet of source it refers to if any.
+func (s *session) report(err error, source string) {
+	switch err.(type) {
+	case compiler.ErrorList, *vm.Error:
+		_, _ = fmt.Fprintln(s.stdout, report(err, source))
+	default:
+		_, _ = fmt.Fprintln(s.stdout, "maki ::", err)
+	}
+}
+
+// command runs a meta-command, that is a line as ":name argument".
+func (s *session) command(line string) {
+	fields := strings.SplitN(strings.TrimPrefix(line, ":"), " ", 2)
+
+	name, arg := fields[0], ""
+	if len(fields) > 1 {
+		arg = strings.TrimSpace(fields[1])
+	}
+
+	c, ok := commands[name]
+	if !ok {
+		s.report(fmt.Errorf("unknown command ':%s', type :help for a list of commands", name), line)
+		return
+	}
+
+	if err := c.run(s, arg); err != nil {
+		s.report(err, arg)
+	}
+}
+
+func (s *session) dis(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("usage %s", commands["dis"].usage)
+	}
+
+	// function defined in session
+	if v, ok := s.vm.Globals()[arg]; ok {
+		if f, ok := v.Ptr.(*vm.Function); ok {
+			_, _ = fmt.Fprint(s.stdout, f)
+			return nil
+		}
+	}
+
+	fun, err := s.compiler.CompileExpression(arg)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprint(s.stdout, fun)
+	return nil
+}
+
+func (s *session) globals(_ string) error {
+	globals := s.vm.Globals()
+
+	identifiers := make([]string, 0, len(globals))
+	for identifier := range globals {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+
+	for _, identifier := range identifiers {
+		v := globals[identifier]
+		_, _ = fmt.Fprintf(s.stdout, "%s :: %s = %s\n", identifier, v.TypeName(), v)
+	}
+	return nil
+}
+
+func (s *session) help(_ string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, _ = fmt.Fprintf(s.stdout, "%-18s %s\n", commands[name].usage, commands[name].description)
+	}
+	return nil
+}
+
+func (s *session) load(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("usage %s", commands["load"].usage)
+	}
+
+	b, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return err
+	}
+
+	if err := interpret(s.compiler, s.vm, string(b)); err != nil {
+		// errors refer to the file, not to the argument
+		s.report(err, string(b))
+	}
+	return nil
+}
+
+func (s *session) clear(_ string) error {
+	s.reset()
+	return nil
+}
+
+func (s *session) time(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("usage %s", commands["time"].usage)
+	}
+
+	fun, err := s.compiler.Compile(arg)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := s.vm.Run(fun); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(s.stdout, "time :: %v\n", time.Since(start))
+	return nil
+}
+
+func (s *session) typeOf(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("usage %s", commands["type"].usage)
+	}
+
+	fun, err := s.compiler.CompileExpression(arg)
+	if err != nil {
+		return err
+	}
+
+	v, err := s.vm.Eval(fun)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(s.stdout, v.TypeName())
+	return nil
+}
+
+// complete returns keywords, compiled globals and VM globals, natives
+// included, starting with word.
+func (s *session) complete(word string) []string {
+	candidates := compiler.Keywords()
+	candidates = append(candidates, s.compiler.Globals()...)
+	for identifier := range s.vm.Globals() {
+		candidates = append(candidates, identifier)
+	}
+
+	seen := make(map[string]bool)
+	matches := make([]string, 0)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) && !seen[candidate] {
+			seen[candidate] = true
+			matches = append(matches, candidate)
+		}
+	}
+
+	return matches
+}
+
+func historyPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "maki", "history"), nil
+}
+
+func loadHistory(editor *readline.Editor) {
+	path, err := historyPath()
+	if err != nil {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_ = editor.LoadHistory(file)
+}
+
+func saveHistory(editor *readline.Editor) {
+	path, err := historyPath()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_ = editor.SaveHistory(file)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"maki/compiler"
+	"maki/vm"
+	"strings"
+)
+
+// report formats err for the user, showing the source code it refers to
+// for compile and runtime errors.
+func report(err error, source string) string {
+	switch e := err.(type) {
+	case compiler.ErrorList:
+		{
+			reports := make([]string, len(e))
+			for i := range e {
+				reports[i] = report(e[i], source)
+			}
+			return strings.Join(reports, "\n")
+		}
+	case *compiler.Error:
+		return withSnippet(e.Error(), source, e.Span())
+	case *vm.Error:
+		return withSnippet(e.Error(), e.Source, e.Span)
+	}
+	return err.Error()
+}
+
+func withSnippet(message, source string, span vm.Span) string {
+	if snippet := vm.Snippet(source, span); snippet != "" {
+		return message + "\n" + snippet
+	}
+	return message
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"maki/compiler"
+	"strings"
+)
+
+// vetFiles implements `maki vet files...`: it reports the warnings found in
+// the files, along with the errors of those that cannot be parsed.
+func vetFiles(paths []string) error {
+	if len(paths) == 0 {
+		return errors.New("Usage: maki vet files...")
+	}
+
+	var reports []string
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			reports = append(reports, err.Error())
+			continue
+		}
+
+		source := string(b)
+		warnings, err := compiler.Vet(source)
+		if err != nil {
+			reports = append(reports, fmt.Sprintf("%s: %s", path, report(err, source)))
+			continue
+		}
+		for _, w := range warnings {
+			reports = append(reports, fmt.Sprintf("%s: %s", path, withSnippet(w.String(), source, w.Span())))
+		}
+	}
+
+	if len(reports) > 0 {
+		return errors.New(strings.Join(reports, "\n"))
+	}
+	return nil
+}
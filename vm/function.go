@@ -6,8 +6,10 @@ import (
 )
 
 type Function struct {
-	Name  string
-	Arity int
+	Name    string
+	Arity   int
+	Source  string   // source code the function is compiled from
+	Symbols *Symbols // slots of the global variables
 	*PCode
 }
 
@@ -23,7 +25,7 @@ func (f Function) String() string {
 	var builder strings.Builder
 
 	builder.WriteString(fmt.Sprintf("__%s__\n", f.Name))
-	builder.WriteString(f.PCode.String())
+	builder.WriteString(f.PCode.disassemble(f.Symbols))
 
 	return builder.String()
 }
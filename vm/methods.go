@@ -0,0 +1,220 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Built-in methods, looked up by name on the value they are called on, e.g.
+// s.upper(). Getting a method binds it to its receiver, calling the bound
+// method runs it.
+
+var (
+	errEmptyArray    = errors.New("array is empty")
+	errNegativeCount = errors.New("count must not be negative")
+	errStringTooLong = errors.New("string too long")
+)
+
+// builtin is the implementation of a method taking arity arguments.
+type builtin struct {
+	arity int
+	fn    func(receiver Value, args []Value) (Value, error)
+}
+
+// method is a builtin bound to its receiver.
+type method struct {
+	name     string
+	receiver Value
+	builtin
+}
+
+func (m *method) call(args []Value) (Value, error) {
+	if len(args) != m.arity {
+		return Value{}, fmt.Errorf("method '%s' takes %d arguments, called with %d", m.name, m.arity, len(args))
+	}
+	return m.fn(m.receiver, args)
+}
+
+var stringMethods = map[string]builtin{
+	"contains": {arity: 1, fn: func(r Value, args []Value) (Value, error) {
+		sub, err := stringArg("contains", args[0])
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{ValueType: Bool, Boolean: strings.Contains(r.Ptr.(string), sub)}, nil
+	}},
+	"endsWith": {arity: 1, fn: func(r Value, args []Value) (Value, error) {
+		suffix, err := stringArg("endsWith", args[0])
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{ValueType: Bool, Boolean: strings.HasSuffix(r.Ptr.(string), suffix)}, nil
+	}},
+	"indexOf": {arity: 1, fn: func(r Value, args []Value) (Value, error) {
+		sub, err := stringArg("indexOf", args[0])
+		if err != nil {
+			return Value{}, err
+		}
+		s := r.Ptr.(string)
+		i := strings.Index(s, sub)
+		if i >= 0 {
+			// in characters, like indexing
+			i = utf8.RuneCountInString(s[:i])
+		}
+		return Value{ValueType: Integer, Int: int64(i)}, nil
+	}},
+	"lower": {arity: 0, fn: func(r Value, _ []Value) (Value, error) {
+		return NewString(strings.ToLower(r.Ptr.(string))), nil
+	}},
+	"repeat": {arity: 1, fn: func(r Value, args []Value) (Value, error) {
+		if args[0].ValueType != Integer {
+			return Value{}, fmt.Errorf("method 'repeat' takes an int, got %s", args[0].TypeName())
+		}
+		s, n := r.Ptr.(string), args[0].Int
+		if n < 0 {
+			return Value{}, errNegativeCount
+		}
+		if len(s) > 0 && n > math.MaxInt32/int64(len(s)) {
+			return Value{}, errStringTooLong
+		}
+		return NewString(strings.Repeat(s, int(n))), nil
+	}},
+	"replace": {arity: 2, fn: func(r Value, args []Value) (Value, error) {
+		old, err := stringArg("replace", args[0])
+		if err != nil {
+			return Value{}, err
+		}
+		new, err := stringArg("replace", args[1])
+		if err != nil {
+			return Value{}, err
+		}
+		return NewString(strings.Replace(r.Ptr.(string), old, new, -1)), nil
+	}},
+	"split": {arity: 1, fn: func(r Value, args []Value) (Value, error) {
+		sep, err := stringArg("split", args[0])
+		if err != nil {
+			return Value{}, err
+		}
+		parts := strings.Split(r.Ptr.(string), sep)
+		values := make([]Value, len(parts))
+		for i, part := range parts {
+			values[i] = NewString(part)
+		}
+		return NewArray(values), nil
+	}},
+	"startsWith": {arity: 1, fn: func(r Value, args []Value) (Value, error) {
+		prefix, err := stringArg("startsWith", args[0])
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{ValueType: Bool, Boolean: strings.HasPrefix(r.Ptr.(string), prefix)}, nil
+	}},
+	"trim": {arity: 0, fn: func(r Value, _ []Value) (Value, error) {
+		return NewString(strings.TrimSpace(r.Ptr.(string))), nil
+	}},
+	"upper": {arity: 0, fn: func(r Value, _ []Value) (Value, error) {
+		return NewString(strings.ToUpper(r.Ptr.(string))), nil
+	}},
+}
+
+var arrayMethods = map[string]builtin{
+	"insert": {arity: 2, fn: func(r Value, args []Value) (Value, error) {
+		array := r.elements()
+		// the element can go after the last one
+		i, err := indexArg("insert", args[0], len(*array), true)
+		if err != nil {
+			return Value{}, err
+		}
+		*array = append(*array, Value{})
+		copy((*array)[i+1:], (*array)[i:])
+		(*array)[i] = args[1]
+		return Value{ValueType: Nil}, nil
+	}},
+	"join": {arity: 1, fn: func(r Value, args []Value) (Value, error) {
+		sep, err := stringArg("join", args[0])
+		if err != nil {
+			return Value{}, err
+		}
+		values := *r.elements()
+		parts := make([]string, len(values))
+		for i, v := range values {
+			parts[i] = v.String()
+		}
+		return NewString(strings.Join(parts, sep)), nil
+	}},
+	"pop": {arity: 0, fn: func(r Value, _ []Value) (Value, error) {
+		array := r.elements()
+		n := len(*array)
+		if n == 0 {
+			return Value{}, errEmptyArray
+		}
+		v := (*array)[n-1]
+		// the slot past the end is cleared so that it does not keep v alive
+		(*array)[n-1] = Value{}
+		*array = (*array)[:n-1]
+		return v, nil
+	}},
+	"push": {arity: 1, fn: func(r Value, args []Value) (Value, error) {
+		array := r.elements()
+		*array = append(*array, args[0])
+		return Value{ValueType: Nil}, nil
+	}},
+	"remove": {arity: 1, fn: func(r Value, args []Value) (Value, error) {
+		array := r.elements()
+		i, err := indexArg("remove", args[0], len(*array), false)
+		if err != nil {
+			return Value{}, err
+		}
+		v := (*array)[i]
+		n := len(*array)
+		copy((*array)[i:], (*array)[i+1:])
+		(*array)[n-1] = Value{}
+		*array = (*array)[:n-1]
+		return v, nil
+	}},
+}
+
+// Property returns the method name of v, bound to v.
+func Property(v Value, name string) (Value, error) {
+	var methods map[string]builtin
+	switch v.ValueType {
+	case Array:
+		methods = arrayMethods
+	case String:
+		methods = stringMethods
+	}
+
+	b, ok := methods[name]
+	if !ok {
+		return Value{}, fmt.Errorf("%s has no method '%s'", v.TypeName(), name)
+	}
+	return Value{ValueType: Object, Ptr: &method{name: name, receiver: v, builtin: b}}, nil
+}
+
+// indexArg returns the position of an element of an array of length
+// elements, counting from the end if v is negative. If end is true, the
+// position after the last element is valid too and -1 is that one.
+func indexArg(name string, v Value, length int, end bool) (int, error) {
+	if v.ValueType != Integer {
+		return 0, fmt.Errorf("method '%s' takes an int index, got %s", name, v.TypeName())
+	}
+	n := length
+	if end {
+		n++
+	}
+	i, ok := position(int(v.Int), n)
+	if !ok {
+		return 0, fmt.Errorf("index out of range with length %d: [%d]", length, v.Int)
+	}
+	return i, nil
+}
+
+func stringArg(name string, v Value) (string, error) {
+	if v.ValueType != String {
+		return "", fmt.Errorf("method '%s' takes a string, got %s", name, v.TypeName())
+	}
+	return v.Ptr.(string), nil
+}
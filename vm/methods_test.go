@@ -0,0 +1,103 @@
+package vm
+
+import "testing"
+
+func TestProperty(t *testing.T) {
+	str := NewString
+	array := func(vs ...Value) Value { return NewArray(vs) }
+
+	tcs := []struct {
+		name     string
+		receiver Value
+		method   string
+		args     []Value
+		want     string
+		after    string // receiver after the call, for the methods changing it
+		err      string
+	}{
+		{name: "Upper", receiver: str("Mäki"), method: "upper", want: "MÄKI"},
+		{name: "Lower", receiver: str("MÄKI"), method: "lower", want: "mäki"},
+		{name: "Trim", receiver: str(" \tMaki\n"), method: "trim", want: "Maki"},
+		{name: "Split", receiver: str("a,b,,c"), method: "split", args: []Value{str(",")}, want: "[ a, b, , c ]"},
+		{name: "Split Characters", receiver: str("äb"), method: "split", args: []Value{str("")}, want: "[ ä, b ]"},
+		{name: "Contains", receiver: str("Maki"), method: "contains", args: []Value{str("ak")}, want: "true"},
+		{name: "Replace", receiver: str("banana"), method: "replace", args: []Value{str("a"), str("o")}, want: "bonono"},
+		{name: "Starts With", receiver: str("Maki"), method: "startsWith", args: []Value{str("Mak")}, want: "true"},
+		{name: "Ends With", receiver: str("Maki"), method: "endsWith", args: []Value{str("Mak")}, want: "false"},
+		{name: "Index Of", receiver: str("èèMaki"), method: "indexOf", args: []Value{str("Maki")}, want: "2"},
+		{name: "Index Of Missing", receiver: str("Maki"), method: "indexOf", args: []Value{str("x")}, want: "-1"},
+		{name: "Repeat", receiver: str("ab"), method: "repeat", args: []Value{makeValue(int64(3))}, want: "ababab"},
+		{name: "Join", receiver: array(str("a"), makeValue(int64(1)), makeValue(true)), method: "join", args: []Value{str(", ")}, want: "a, 1, true"},
+		{name: "Push", receiver: array(str("a")), method: "push", args: []Value{str("b")}, want: "nil", after: "[ a, b ]"},
+		{name: "Pop", receiver: array(str("a"), str("b")), method: "pop", want: "b", after: "[ a ]"},
+		{name: "Pop Empty", receiver: array(), method: "pop", err: "array is empty"},
+		{name: "Insert", receiver: array(str("a"), str("c")), method: "insert", args: []Value{makeValue(int64(1)), str("b")}, want: "nil", after: "[ a, b, c ]"},
+		{name: "Insert At End", receiver: array(str("a")), method: "insert", args: []Value{makeValue(int64(-1)), str("b")}, want: "nil", after: "[ a, b ]"},
+		{name: "Insert Out Of Range", receiver: array(str("a")), method: "insert", args: []Value{makeValue(int64(2)), str("b")}, err: "index out of range with length 1: [2]"},
+		{name: "Remove", receiver: array(str("a"), str("b"), str("c")), method: "remove", args: []Value{makeValue(int64(-2))}, want: "b", after: "[ a, c ]"},
+		{name: "Remove Out Of Range", receiver: array(str("a")), method: "remove", args: []Value{makeValue(int64(1))}, err: "index out of range with length 1: [1]"},
+		{name: "Remove Wrong Type", receiver: array(str("a")), method: "remove", args: []Value{str("a")}, err: "method 'remove' takes an int index, got string"},
+		{name: "Unknown Method", receiver: str("Maki"), method: "size", err: "string has no method 'size'"},
+		{name: "No Methods", receiver: makeValue(int64(1)), method: "upper", err: "int has no method 'upper'"},
+		{name: "Wrong Count", receiver: str("Maki"), method: "upper", args: []Value{str("")}, err: "method 'upper' takes 0 arguments, called with 1"},
+		{name: "Wrong Type", receiver: str("Maki"), method: "contains", args: []Value{makeValue(int64(1))}, err: "method 'contains' takes a string, got int"},
+		{name: "Negative Repeat", receiver: str("ab"), method: "repeat", args: []Value{makeValue(int64(-1))}, err: "count must not be negative"},
+		{name: "Repeat Too Long", receiver: str("ab"), method: "repeat", args: []Value{makeValue(int64(1) << 40)}, err: "string too long"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Property(tc.receiver, tc.method)
+			var got Value
+			if err == nil {
+				got, err = m.Ptr.(*method).call(tc.args)
+			}
+
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got %v, want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want nil", err)
+			}
+			if got.String() != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+			if tc.after != "" && tc.receiver.String() != tc.after {
+				t.Errorf("got receiver %v, want %v", tc.receiver, tc.after)
+			}
+		})
+	}
+}
+
+func TestProperty_Release(t *testing.T) {
+	tcs := []struct {
+		name   string
+		method string
+		args   []Value
+	}{
+		{name: "Pop", method: "pop"},
+		{name: "Remove", method: "remove", args: []Value{makeValue(int64(0))}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewArray([]Value{NewString("a"), NewString("b")})
+			m, err := Property(a, tc.method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Ptr.(*method).call(tc.args); err != nil {
+				t.Fatal(err)
+			}
+
+			// the slot past the end must not keep the removed element alive
+			elements := *a.elements()
+			if got := elements[:cap(elements)][1]; got.Ptr != nil {
+				t.Errorf("got %v past the end, want nothing", got)
+			}
+		})
+	}
+}
@@ -2,28 +2,161 @@ package vm
 
 import (
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
+// Native is a function implemented in Go. Errors are reported as runtime
+// errors of the call.
 type Native interface {
-	Function(vs []Value) Value
+	Function(vm *VM, vs []Value) (Value, error)
 }
 
 type Println struct{}
 
-func (p Println) Function(vs []Value) Value {
+func (p Println) Function(vm *VM, vs []Value) (Value, error) {
 	for _, v := range vs {
-		fmt.Print(v)
+		_, _ = fmt.Fprint(vm.stdout, v)
 	}
-	fmt.Println()
-	return Value{ValueType: Nil}
+	_, _ = fmt.Fprintln(vm.stdout)
+	return Value{ValueType: Nil}, nil
+}
+
+type Readln struct{}
+
+func (r Readln) Function(vm *VM, _ []Value) (Value, error) {
+	line, err := vm.stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return Value{ValueType: Nil}, nil
+	}
+	return NewString(strings.TrimRight(line, "\r\n")), nil
 }
 
 type Clock struct{}
 
-func (c Clock) Function(_ []Value) Value {
+func (c Clock) Function(_ *VM, _ []Value) (Value, error) {
 	return Value{
-		ValueType: Number,
-		Float:     float64(time.Now().Unix()),
+		ValueType: Integer,
+		Int:       time.Now().Unix(),
+	}, nil
+}
+
+// Len returns the number of elements of an array or of characters of a
+// string. Other values are an error.
+type Len struct{}
+
+func (l Len) Function(_ *VM, vs []Value) (Value, error) {
+	if err := single("len", vs); err != nil {
+		return Value{}, err
+	}
+
+	switch v := vs[0]; v.ValueType {
+	case Array:
+		return Value{ValueType: Integer, Int: int64(len(*v.elements()))}, nil
+	case String:
+		return Value{ValueType: Integer, Int: int64(utf8.RuneCountInString(v.Ptr.(string)))}, nil
+	default:
+		return Value{}, fmt.Errorf("len expects an array or a string, got %s", v.TypeName())
+	}
+}
+
+// Copy returns a shallow copy of an array: a new array holding the same
+// elements. Other values are returned as they are.
+type Copy struct{}
+
+func (c Copy) Function(_ *VM, vs []Value) (Value, error) {
+	if err := single("copy", vs); err != nil {
+		return Value{}, err
+	}
+
+	v := vs[0]
+	if v.ValueType == Array {
+		return NewArray(append([]Value(nil), *v.elements()...)), nil
+	}
+	return v, nil
+}
+
+// ToBigInt converts an integer, a decimal, a float or a string to a big
+// integer, truncating toward zero. It returns nil if the value cannot be
+// converted.
+type ToBigInt struct{}
+
+func (b ToBigInt) Function(_ *VM, vs []Value) (Value, error) {
+	if err := single("bigint", vs); err != nil {
+		return Value{}, err
+	}
+
+	switch v := vs[0]; v.ValueType {
+	case BigInt, Integer:
+		return NewBigInt(toBigInt(v)), nil
+	case Decimal:
+		{
+			r := v.Ptr.(*big.Rat)
+			return NewBigInt(new(big.Int).Quo(r.Num(), r.Denom())), nil
+		}
+	case Number:
+		{
+			if math.IsInf(v.Float, 0) || math.IsNaN(v.Float) {
+				break
+			}
+			n, _ := big.NewFloat(v.Float).Int(nil)
+			return NewBigInt(n), nil
+		}
+	case String:
+		{
+			if n, ok := new(big.Int).SetString(v.Ptr.(string), 10); ok {
+				return NewBigInt(n), nil
+			}
+		}
+	}
+	return Value{ValueType: Nil}, nil
+}
+
+// ToDecimal converts an integer, a float or a string to a decimal. Floats are
+// converted from their shortest representation, so that decimal(0.1) is 0.1.
+// It returns nil if the value cannot be converted.
+type ToDecimal struct{}
+
+func (d ToDecimal) Function(_ *VM, vs []Value) (Value, error) {
+	if err := single("decimal", vs); err != nil {
+		return Value{}, err
+	}
+
+	switch v := vs[0]; v.ValueType {
+	case BigInt, Decimal, Integer:
+		{
+			r, _ := toRat(v)
+			return NewDecimal(r), nil
+		}
+	case Number:
+		{
+			if math.IsInf(v.Float, 0) || math.IsNaN(v.Float) {
+				break
+			}
+			r, _ := new(big.Rat).SetString(strconv.FormatFloat(v.Float, 'g', -1, 64))
+			return NewDecimal(r), nil
+		}
+	case String:
+		{
+			s := v.Ptr.(string)
+			if r, ok := new(big.Rat).SetString(s); ok && s != "" {
+				return NewDecimal(r), nil
+			}
+		}
+	}
+	return Value{ValueType: Nil}, nil
+}
+
+// single returns an error unless the native called name is given exactly one
+// argument, as all the natives taking arguments are.
+func single(name string, vs []Value) error {
+	if len(vs) != 1 {
+		return fmt.Errorf("%s expects 1 argument, got %d", name, len(vs))
 	}
+	return nil
 }
@@ -0,0 +1,627 @@
+package vm
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Operators on values, shared by the VM and by the compiler folding constant
+// expressions. Integers stay integers and are promoted to big integers when
+// the result does not fit in int64, big integers results that fit go back to
+// integers. Big integers are promoted to decimals, which are exact, and every
+// kind but decimals to float when mixed with a float.
+
+var (
+	errDecimalExponent  = errors.New("decimal exponent must be an integer")
+	errDivisionByZero   = errors.New("division by zero")
+	errExponentTooLarge = errors.New("exponent too large")
+	errIntegerOperand   = errors.New("operand must be an integer")
+	errIntegerOperands  = errors.New("operands must be integers")
+	errInvalidOperand   = errors.New("operand must be a number")
+	errInvalidOperands  = errors.New("invalid binary operands")
+	errMixedDecimal     = errors.New("cannot mix decimal and float operands")
+	errNegativeShift    = errors.New("negative shift count")
+	errNotContainer     = errors.New("operand of 'in' must be an array or a string")
+	errShiftTooLarge    = errors.New("shift count too large")
+)
+
+// maxBits is the size limit of the results of shifts and powers, which would
+// otherwise take gigabytes for counts and exponents that fit in int64.
+const maxBits = 1 << 24
+
+// isNumber tells whether v is an integer, a decimal or a float.
+func isNumber(v Value) bool {
+	switch v.ValueType {
+	case BigInt, Decimal, Integer, Number:
+		return true
+	}
+	return false
+}
+
+// isInteger tells whether v is an integer, big or not.
+func isInteger(v Value) bool {
+	return v.ValueType == Integer || v.ValueType == BigInt
+}
+
+// isBig tells whether v is a big integer or a decimal.
+func isBig(v Value) bool {
+	return v.ValueType == BigInt || v.ValueType == Decimal
+}
+
+// toFloat returns the value of a number as float.
+func toFloat(v Value) float64 {
+	switch v.ValueType {
+	case BigInt:
+		{
+			f, _ := new(big.Float).SetInt(v.Ptr.(*big.Int)).Float64()
+			return f
+		}
+	case Decimal:
+		{
+			f, _ := v.Ptr.(*big.Rat).Float64()
+			return f
+		}
+	case Integer:
+		return float64(v.Int)
+	}
+	return v.Float
+}
+
+// toBigInt returns the value of an integer, big or not, as big integer.
+func toBigInt(v Value) *big.Int {
+	if v.ValueType == Integer {
+		return big.NewInt(v.Int)
+	}
+	return v.Ptr.(*big.Int)
+}
+
+// normalize returns n as integer if it fits in int64, as big integer
+// otherwise, so that operations go back to the fast path.
+func normalize(n *big.Int) Value {
+	if n.IsInt64() {
+		return Value{ValueType: Integer, Int: n.Int64()}
+	}
+	return NewBigInt(n)
+}
+
+// tooLarge tells whether n ** exp has more than maxBits bits, exp >= 0.
+func tooLarge(n *big.Int, exp int64) bool {
+	bits := int64(n.BitLen())
+	if n.CmpAbs(big.NewInt(1)) <= 0 {
+		// 0, 1 and -1 keep their size
+		return false
+	}
+	return exp > maxBits/bits
+}
+
+// toRat returns the exact value of a number, it returns false for the floats
+// that are infinite or not a number.
+func toRat(v Value) (*big.Rat, bool) {
+	switch v.ValueType {
+	case BigInt:
+		return new(big.Rat).SetInt(v.Ptr.(*big.Int)), true
+	case Decimal:
+		return v.Ptr.(*big.Rat), true
+	case Integer:
+		return new(big.Rat).SetInt64(v.Int), true
+	}
+	if math.IsInf(v.Float, 0) || math.IsNaN(v.Float) {
+		return nil, false
+	}
+	return new(big.Rat).SetFloat64(v.Float), true
+}
+
+// Arithmetic applies OpAdd, OpSubtract, OpMultiply, OpDivide,
+// OpIntegerDivide, OpModulo or OpPower to two numbers, OpAdd concatenates
+// strings as well. Dividing integers always gives a float, or a decimal for
+// big integers, whatever their values. OpIntegerDivide takes integers only
+// and truncates toward zero. Raising integers to a negative power gives a
+// float.
+func Arithmetic(op OpCode, lhs, rhs Value) (Value, error) {
+	if op == OpIntegerDivide && (!isInteger(lhs) || !isInteger(rhs)) {
+		return Value{}, errIntegerOperands
+	}
+
+	if lhs.ValueType == Integer && rhs.ValueType == Integer {
+		return integerArithmetic(op, lhs.Int, rhs.Int)
+	}
+
+	if isNumber(lhs) && isNumber(rhs) {
+		switch {
+		case lhs.ValueType == Number || rhs.ValueType == Number:
+			{
+				if lhs.ValueType == Decimal || rhs.ValueType == Decimal {
+					return Value{}, errMixedDecimal
+				}
+				return floatArithmetic(op, toFloat(lhs), toFloat(rhs))
+			}
+		case lhs.ValueType == Decimal || rhs.ValueType == Decimal:
+			{
+				l, _ := toRat(lhs)
+				r, _ := toRat(rhs)
+				return decimalArithmetic(op, l, r)
+			}
+		}
+		return bigIntArithmetic(op, toBigInt(lhs), toBigInt(rhs))
+	}
+
+	if op == OpAdd {
+		if lhs.ValueType == String && rhs.ValueType == String {
+			return NewString(lhs.Ptr.(string) + rhs.Ptr.(string)), nil
+		}
+		if lhs.ValueType == Array && rhs.ValueType == Array {
+			values := append(append([]Value(nil), *lhs.elements()...), *rhs.elements()...)
+			return NewArray(values), nil
+		}
+	}
+	return Value{}, errInvalidOperands
+}
+
+func integerArithmetic(op OpCode, l, r int64) (Value, error) {
+	var n int64
+	overflow := false
+	switch op {
+	case OpAdd:
+		{
+			n = l + r
+			overflow = (n > l) != (r > 0)
+		}
+	case OpSubtract:
+		{
+			n = l - r
+			overflow = (n < l) != (r > 0)
+		}
+	case OpMultiply:
+		{
+			var ok bool
+			n, ok = multiply(l, r)
+			overflow = !ok
+		}
+	case OpPower:
+		{
+			if r < 0 {
+				return floatArithmetic(op, float64(l), float64(r))
+			}
+			var ok bool
+			n, ok = power(l, r)
+			overflow = !ok
+		}
+	case OpDivide, OpIntegerDivide, OpModulo:
+		{
+			if r == 0 {
+				return Value{}, errDivisionByZero
+			}
+			switch {
+			case op == OpModulo:
+				n = l % r
+			case op == OpDivide:
+				return floatArithmetic(op, float64(l), float64(r))
+			default:
+				n = l / r
+				overflow = l == math.MinInt64 && r == -1
+			}
+		}
+	default:
+		return Value{}, errInvalidOperands
+	}
+
+	if overflow {
+		return bigIntArithmetic(op, big.NewInt(l), big.NewInt(r))
+	}
+	return Value{ValueType: Integer, Int: n}, nil
+}
+
+// multiply returns l * r, it returns false on overflow.
+func multiply(l, r int64) (int64, bool) {
+	n := l * r
+	if l != 0 && (n/l != r || (l == -1 && r == math.MinInt64)) {
+		return 0, false
+	}
+	return n, true
+}
+
+// power returns base ** exp for exp >= 0, squaring base for each bit of exp.
+// It returns false on overflow.
+func power(base, exp int64) (int64, bool) {
+	n := int64(1)
+	for ok := true; exp > 0; exp >>= 1 {
+		if exp&1 == 1 {
+			if n, ok = multiply(n, base); !ok {
+				return 0, false
+			}
+		}
+		if exp > 1 {
+			if base, ok = multiply(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return n, true
+}
+
+func bigIntArithmetic(op OpCode, l, r *big.Int) (Value, error) {
+	n := new(big.Int)
+	switch op {
+	case OpAdd:
+		n.Add(l, r)
+	case OpSubtract:
+		n.Sub(l, r)
+	case OpMultiply:
+		n.Mul(l, r)
+	case OpPower:
+		{
+			if r.Sign() < 0 {
+				return floatArithmetic(op, toFloat(NewBigInt(l)), toFloat(NewBigInt(r)))
+			}
+			if !r.IsInt64() || tooLarge(l, r.Int64()) {
+				return Value{}, errExponentTooLarge
+			}
+			n.Exp(l, r, nil)
+		}
+	case OpDivide, OpIntegerDivide, OpModulo:
+		{
+			if r.Sign() == 0 {
+				return Value{}, errDivisionByZero
+			}
+			if op == OpDivide {
+				// exact, like big integers are
+				return NewDecimal(new(big.Rat).SetFrac(l, r)), nil
+			}
+			rem := new(big.Int)
+			n.QuoRem(l, r, rem)
+			if op == OpModulo {
+				n = rem
+			}
+		}
+	default:
+		return Value{}, errInvalidOperands
+	}
+	return normalize(n), nil
+}
+
+func decimalArithmetic(op OpCode, l, r *big.Rat) (Value, error) {
+	n := new(big.Rat)
+	switch op {
+	case OpAdd:
+		n.Add(l, r)
+	case OpSubtract:
+		n.Sub(l, r)
+	case OpMultiply:
+		n.Mul(l, r)
+	case OpPower:
+		{
+			if !r.IsInt() {
+				return Value{}, errDecimalExponent
+			}
+			exp := r.Num()
+			if !exp.IsInt64() {
+				return Value{}, errExponentTooLarge
+			}
+			if l.Sign() == 0 && exp.Sign() < 0 {
+				return Value{}, errDivisionByZero
+			}
+
+			abs := new(big.Int).Abs(exp)
+			if tooLarge(l.Num(), abs.Int64()) || tooLarge(l.Denom(), abs.Int64()) {
+				return Value{}, errExponentTooLarge
+			}
+			num := new(big.Int).Exp(l.Num(), abs, nil)
+			denom := new(big.Int).Exp(l.Denom(), abs, nil)
+			if exp.Sign() < 0 {
+				num, denom = denom, num
+			}
+			n.SetFrac(num, denom)
+		}
+	case OpDivide, OpModulo:
+		{
+			if r.Sign() == 0 {
+				return Value{}, errDivisionByZero
+			}
+			n.Quo(l, r)
+			if op == OpModulo {
+				// l - r * q, where q is the quotient truncated toward zero
+				q := new(big.Int).Quo(n.Num(), n.Denom())
+				n.Mul(r, new(big.Rat).SetInt(q))
+				n.Sub(l, n)
+			}
+		}
+	default:
+		return Value{}, errInvalidOperands
+	}
+	return NewDecimal(n), nil
+}
+
+func floatArithmetic(op OpCode, l, r float64) (Value, error) {
+	v := Value{ValueType: Number}
+	switch op {
+	case OpAdd:
+		v.Float = l + r
+	case OpSubtract:
+		v.Float = l - r
+	case OpMultiply:
+		v.Float = l * r
+	case OpDivide:
+		v.Float = l / r
+	case OpModulo:
+		v.Float = math.Mod(l, r)
+	case OpPower:
+		v.Float = math.Pow(l, r)
+	default:
+		return Value{}, errInvalidOperands
+	}
+	return v, nil
+}
+
+// Bitwise applies OpBitAnd, OpBitOr, OpBitXor, OpShiftLeft or OpShiftRight to
+// two integers, big or not. Negative integers behave as in two's complement,
+// shifting right keeps their sign.
+func Bitwise(op OpCode, lhs, rhs Value) (Value, error) {
+	if !isInteger(lhs) || !isInteger(rhs) {
+		return Value{}, errIntegerOperands
+	}
+	if op == OpShiftLeft || op == OpShiftRight {
+		return shift(op, lhs, rhs)
+	}
+
+	if lhs.ValueType == Integer && rhs.ValueType == Integer {
+		v := Value{ValueType: Integer}
+		switch op {
+		case OpBitAnd:
+			v.Int = lhs.Int & rhs.Int
+		case OpBitOr:
+			v.Int = lhs.Int | rhs.Int
+		case OpBitXor:
+			v.Int = lhs.Int ^ rhs.Int
+		default:
+			return Value{}, errInvalidOperands
+		}
+		return v, nil
+	}
+
+	l, r, n := toBigInt(lhs), toBigInt(rhs), new(big.Int)
+	switch op {
+	case OpBitAnd:
+		n.And(l, r)
+	case OpBitOr:
+		n.Or(l, r)
+	case OpBitXor:
+		n.Xor(l, r)
+	default:
+		return Value{}, errInvalidOperands
+	}
+	return normalize(n), nil
+}
+
+// shift shifts an integer by a count, shifting left gives a big integer when
+// the result does not fit in int64.
+func shift(op OpCode, lhs, rhs Value) (Value, error) {
+	if rhs.ValueType == BigInt {
+		if rhs.Ptr.(*big.Int).Sign() < 0 {
+			return Value{}, errNegativeShift
+		}
+		return Value{}, errShiftTooLarge
+	}
+	if rhs.Int < 0 {
+		return Value{}, errNegativeShift
+	}
+
+	count := uint(rhs.Int)
+	if lhs.ValueType == Integer {
+		l := lhs.Int
+		switch {
+		case op == OpShiftRight && count > 63:
+			return Value{ValueType: Integer, Int: l >> 63}, nil
+		case op == OpShiftRight:
+			return Value{ValueType: Integer, Int: l >> count}, nil
+		case count < 64 && (l<<count)>>count == l:
+			return Value{ValueType: Integer, Int: l << count}, nil
+		}
+	}
+
+	l := toBigInt(lhs)
+	if op == OpShiftRight {
+		return normalize(new(big.Int).Rsh(l, count)), nil
+	}
+	if l.Sign() != 0 && rhs.Int > maxBits-int64(l.BitLen()) {
+		return Value{}, errShiftTooLarge
+	}
+	return normalize(new(big.Int).Lsh(l, count)), nil
+}
+
+// Complement returns the bitwise complement of an integer, that is -v - 1.
+func Complement(v Value) (Value, error) {
+	switch v.ValueType {
+	case BigInt:
+		return normalize(new(big.Int).Not(v.Ptr.(*big.Int))), nil
+	case Integer:
+		return Value{ValueType: Integer, Int: ^v.Int}, nil
+	}
+	return Value{}, errIntegerOperand
+}
+
+// compare returns -1, 0 or +1 as lhs is less than, equal to or greater than
+// rhs, it returns false if one of them is not a number.
+func compare(lhs, rhs Value) (int, bool) {
+	if lhs.ValueType == Integer && rhs.ValueType == Integer {
+		switch {
+		case lhs.Int < rhs.Int:
+			return -1, true
+		case lhs.Int > rhs.Int:
+			return +1, true
+		}
+		return 0, true
+	}
+
+	// integers past 2^53 have no exact float, they are compared exactly
+	if lhs.ValueType == Integer && rhs.ValueType == Number {
+		return compareIntFloat(lhs.Int, rhs.Float)
+	}
+	if lhs.ValueType == Number && rhs.ValueType == Integer {
+		c, ok := compareIntFloat(rhs.Int, lhs.Float)
+		return -c, ok
+	}
+
+	if !isBig(lhs) && !isBig(rhs) {
+		l, r := toFloat(lhs), toFloat(rhs)
+		switch {
+		case l < r:
+			return -1, true
+		case l > r:
+			return +1, true
+		case l == r:
+			return 0, true
+		}
+		return 0, false
+	}
+
+	// big numbers are compared exactly, to floats too
+	l, lok := toRat(lhs)
+	r, rok := toRat(rhs)
+	switch {
+	case lok && rok:
+		return l.Cmp(r), true
+	case !lok && math.IsInf(lhs.Float, 0):
+		return int(math.Copysign(1, lhs.Float)), true
+	case !rok && math.IsInf(rhs.Float, 0):
+		return -int(math.Copysign(1, rhs.Float)), true
+	}
+	return 0, false
+}
+
+// compareIntFloat compares an integer to a float exactly, it returns false if
+// f is not a number.
+func compareIntFloat(i int64, f float64) (int, bool) {
+	switch {
+	case math.IsNaN(f):
+		return 0, false
+	case f >= math.MaxInt64:
+		// 2^63, the first float past the integers
+		return -1, true
+	case f < math.MinInt64:
+		return +1, true
+	}
+
+	// the integral part of f fits in int64, what is left is its fraction
+	t := math.Trunc(f)
+	switch n := int64(t); {
+	case i < n:
+		return -1, true
+	case i > n:
+		return +1, true
+	case f > t:
+		return -1, true
+	case f < t:
+		return +1, true
+	}
+	return 0, true
+}
+
+// Compare applies OpGreater, OpGreaterEqual, OpLess or OpLessEqual to two
+// numbers.
+func Compare(op OpCode, lhs, rhs Value) (Value, error) {
+	if !isNumber(lhs) || !isNumber(rhs) {
+		return Value{}, errInvalidOperands
+	}
+
+	v := Value{ValueType: Bool}
+	c, ok := compare(lhs, rhs)
+	if !ok {
+		return v, nil
+	}
+
+	switch op {
+	case OpGreater:
+		v.Boolean = c > 0
+	case OpGreaterEqual:
+		v.Boolean = c >= 0
+	case OpLess:
+		v.Boolean = c < 0
+	case OpLessEqual:
+		v.Boolean = c <= 0
+	}
+	return v, nil
+}
+
+// Equal tells whether two values are equal: nil is equal to nil only, numbers
+// are equal when their values are, whatever their kind, other types cannot be
+// compared to each other.
+func Equal(lhs, rhs Value) (bool, error) {
+	if isNumber(lhs) && isNumber(rhs) {
+		c, ok := compare(lhs, rhs)
+		return ok && c == 0, nil
+	}
+
+	if lhs.ValueType != rhs.ValueType {
+		if lhs.ValueType == Nil || rhs.ValueType == Nil {
+			return false, nil
+		}
+		return false, errInvalidOperands
+	}
+
+	switch lhs.ValueType {
+	case Array:
+		// arrays are references, equal if they are the same array
+		return lhs.Ptr == rhs.Ptr, nil
+	case Bool:
+		return lhs.Boolean == rhs.Boolean, nil
+	case Nil:
+		return true, nil
+	case Object:
+		return false, errInvalidOperands
+	case String:
+		return lhs.Ptr.(string) == rhs.Ptr.(string), nil
+	}
+	return true, nil
+}
+
+// Contains reports whether container, an array or a string, holds v: an
+// element equal to v or, for strings, the substring v.
+func Contains(container, v Value) (Value, error) {
+	switch container.ValueType {
+	case Array:
+		for _, e := range *container.elements() {
+			// values that cannot be compared are different
+			if equal, err := Equal(e, v); err == nil && equal {
+				return Value{ValueType: Bool, Boolean: true}, nil
+			}
+		}
+		return Value{ValueType: Bool, Boolean: false}, nil
+	case String:
+		if v.ValueType != String {
+			return Value{}, errInvalidOperands
+		}
+		return Value{ValueType: Bool, Boolean: strings.Contains(container.Ptr.(string), v.Ptr.(string))}, nil
+	}
+	return Value{}, errNotContainer
+}
+
+// Concat returns the string made of values, as printed.
+func Concat(values []Value) Value {
+	var b strings.Builder
+	for _, v := range values {
+		b.WriteString(v.String())
+	}
+	return NewString(b.String())
+}
+
+// Negate returns the opposite of a number.
+func Negate(v Value) (Value, error) {
+	switch v.ValueType {
+	case BigInt:
+		return normalize(new(big.Int).Neg(v.Ptr.(*big.Int))), nil
+	case Decimal:
+		return NewDecimal(new(big.Rat).Neg(v.Ptr.(*big.Rat))), nil
+	case Integer:
+		{
+			if v.Int == math.MinInt64 {
+				return NewBigInt(new(big.Int).Neg(big.NewInt(v.Int))), nil
+			}
+			return Value{ValueType: Integer, Int: -v.Int}, nil
+		}
+	case Number:
+		return Value{ValueType: Number, Float: -v.Float}, nil
+	}
+	return Value{}, errInvalidOperand
+}
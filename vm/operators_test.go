@@ -0,0 +1,372 @@
+package vm
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func bigInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 10)
+	return n
+}
+
+func decimal(s string) *big.Rat {
+	r, _ := new(big.Rat).SetString(s)
+	return r
+}
+
+func TestArithmetic(t *testing.T) {
+	tcs := []struct {
+		name string
+		op   OpCode
+		lhs  interface{}
+		rhs  interface{}
+		want string
+		err  error
+	}{
+		{name: "Integer Add", op: OpAdd, lhs: int64(1), rhs: int64(2), want: "3"},
+		{name: "Float Add", op: OpAdd, lhs: 1.5, rhs: 2.5, want: "4.0"},
+		{name: "Promoted Add", op: OpAdd, lhs: int64(1), rhs: 0.5, want: "1.5"},
+		{name: "Promoted Subtract", op: OpSubtract, lhs: 0.5, rhs: int64(1), want: "-0.5"},
+		{name: "Promoted Multiply", op: OpMultiply, lhs: int64(2), rhs: 1.5, want: "3.0"},
+		{name: "Integer Divide", op: OpDivide, lhs: int64(7), rhs: int64(2), want: "3.5"},
+		{name: "Exact Integer Divide", op: OpDivide, lhs: int64(-8), rhs: int64(2), want: "-4.0"},
+		{name: "Integer Division", op: OpIntegerDivide, lhs: int64(7), rhs: int64(2), want: "3"},
+		{name: "Integer Division Truncates", op: OpIntegerDivide, lhs: int64(-7), rhs: int64(2), want: "-3"},
+		{name: "Integer Division Of Float", op: OpIntegerDivide, lhs: 7.0, rhs: int64(2), err: errIntegerOperands},
+		{name: "Integer Division By Zero", op: OpIntegerDivide, lhs: int64(1), rhs: int64(0), err: errDivisionByZero},
+		{name: "Float Divide", op: OpDivide, lhs: 7.0, rhs: int64(2), want: "3.5"},
+		{name: "Float Divide By Zero", op: OpDivide, lhs: 1.0, rhs: 0.0, want: "+Inf"},
+		{name: "Integer Divide By Zero", op: OpDivide, lhs: int64(1), rhs: int64(0), err: errDivisionByZero},
+		{name: "Integer Modulo", op: OpModulo, lhs: int64(-7), rhs: int64(3), want: "-1"},
+		{name: "Float Modulo", op: OpModulo, lhs: 7.5, rhs: int64(2), want: "1.5"},
+		{name: "Integer Modulo By Zero", op: OpModulo, lhs: int64(1), rhs: int64(0), err: errDivisionByZero},
+		{name: "Add Overflow", op: OpAdd, lhs: int64(math.MaxInt64), rhs: int64(1), want: "9223372036854775808"},
+		{name: "Subtract Overflow", op: OpSubtract, lhs: int64(math.MinInt64), rhs: int64(1), want: "-9223372036854775809"},
+		{name: "Multiply Overflow", op: OpMultiply, lhs: int64(math.MaxInt64), rhs: int64(2), want: "18446744073709551614"},
+		{name: "Divide Overflow", op: OpDivide, lhs: int64(math.MinInt64), rhs: int64(-1), want: "9.223372036854776e+18"},
+		{name: "Modulo Overflow", op: OpModulo, lhs: int64(math.MinInt64), rhs: int64(-1), want: "0"},
+		{name: "Negative Multiply Overflow", op: OpMultiply, lhs: int64(-1), rhs: int64(math.MinInt64), want: "9223372036854775808"},
+		{name: "Big Integer Add", op: OpAdd, lhs: bigInt("9223372036854775808"), rhs: int64(-1), want: "9223372036854775807"},
+		{name: "Big Integer Divide", op: OpDivide, lhs: bigInt("-100000000000000000000"), rhs: bigInt("4"), want: "-25000000000000000000.0"},
+		{name: "Big Integer Divide By Integer", op: OpDivide, lhs: bigInt("100000000000000000000"), rhs: int64(8), want: "12500000000000000000.0"},
+		{name: "Big Integer Divide To Decimal", op: OpDivide, lhs: bigInt("100000000000000000001"), rhs: int64(4), want: "25000000000000000000.25"},
+		{name: "Big Integer Division", op: OpIntegerDivide, lhs: bigInt("-100000000000000000000"), rhs: bigInt("3"), want: "-33333333333333333333"},
+		{name: "Big Integer Modulo", op: OpModulo, lhs: bigInt("-100000000000000000000"), rhs: int64(3), want: "-1"},
+		{name: "Big Integer Divide By Zero", op: OpDivide, lhs: bigInt("1"), rhs: bigInt("0"), err: errDivisionByZero},
+		{name: "Big Integer And Float", op: OpMultiply, lhs: bigInt("3"), rhs: 0.5, want: "1.5"},
+		{name: "Decimal Add", op: OpAdd, lhs: decimal("0.1"), rhs: decimal("0.2"), want: "0.3"},
+		{name: "Decimal And Integer", op: OpMultiply, lhs: decimal("19.99"), rhs: int64(3), want: "59.97"},
+		{name: "Decimal And Big Integer", op: OpSubtract, lhs: bigInt("10000000000000000000"), rhs: decimal("0.01"), want: "9999999999999999999.99"},
+		{name: "Whole Decimal", op: OpMultiply, lhs: decimal("1.5"), rhs: int64(2), want: "3.0"},
+		{name: "Decimal Divide", op: OpDivide, lhs: decimal("1"), rhs: int64(8), want: "0.125"},
+		{name: "Repeating Decimal Divide", op: OpDivide, lhs: decimal("2"), rhs: int64(3), want: "0.6666666666666666666666666667"},
+		{name: "Decimal Modulo", op: OpModulo, lhs: decimal("-7.5"), rhs: int64(2), want: "-1.5"},
+		{name: "Decimal Divide By Zero", op: OpDivide, lhs: decimal("1"), rhs: int64(0), err: errDivisionByZero},
+		{name: "Decimal And Float", op: OpAdd, lhs: decimal("1"), rhs: 1.0, err: errMixedDecimal},
+		{name: "Integer Power", op: OpPower, lhs: int64(3), rhs: int64(4), want: "81"},
+		{name: "Negative Power", op: OpPower, lhs: int64(2), rhs: int64(-2), want: "0.25"},
+		{name: "Power Overflow", op: OpPower, lhs: int64(2), rhs: int64(64), want: "18446744073709551616"},
+		{name: "Negative Base Power", op: OpPower, lhs: int64(-2), rhs: int64(63), want: "-9223372036854775808"},
+		{name: "Float Power", op: OpPower, lhs: 4.0, rhs: 0.5, want: "2.0"},
+		{name: "Big Integer Power", op: OpPower, lhs: bigInt("10"), rhs: int64(20), want: "100000000000000000000"},
+		{name: "Decimal Power", op: OpPower, lhs: decimal("1.1"), rhs: int64(2), want: "1.21"},
+		{name: "Decimal Negative Power", op: OpPower, lhs: decimal("0.5"), rhs: int64(-3), want: "8.0"},
+		{name: "Decimal Fractional Power", op: OpPower, lhs: decimal("2"), rhs: decimal("0.5"), err: errDecimalExponent},
+		{name: "Decimal Zero Negative Power", op: OpPower, lhs: decimal("0"), rhs: int64(-1), err: errDivisionByZero},
+		{name: "Power Too Large", op: OpPower, lhs: int64(2), rhs: int64(4000000000), err: errExponentTooLarge},
+		{name: "Big Integer Power Too Large", op: OpPower, lhs: bigInt("18446744073709551616"), rhs: int64(1 << 20), err: errExponentTooLarge},
+		{name: "Decimal Power Too Large", op: OpPower, lhs: decimal("1.5"), rhs: int64(4000000000), err: errExponentTooLarge},
+		{name: "Large Power Of One", op: OpPower, lhs: int64(-1), rhs: int64(4000000001), want: "-1"},
+		{name: "Boolean Operand", op: OpAdd, lhs: true, rhs: int64(1), err: errInvalidOperands},
+		{name: "String Add", op: OpAdd, lhs: "Ma", rhs: "ki", want: "Maki"},
+		{name: "Array Add", op: OpAdd, lhs: []Value{makeValue(int64(1))}, rhs: []Value{makeValue("a"), makeValue(true)}, want: "[ 1, a, true ]"},
+		{name: "Array And Integer Add", op: OpAdd, lhs: []Value{}, rhs: int64(1), err: errInvalidOperands},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := Arithmetic(tc.op, makeValue(tc.lhs), makeValue(tc.rhs))
+			if err != tc.err {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if err == nil && v.String() != tc.want {
+				t.Errorf("got %v, want %v", v, tc.want)
+			}
+		})
+	}
+}
+
+func TestArithmetic_Normalize(t *testing.T) {
+	tcs := []struct {
+		name  string
+		apply func(OpCode, Value, Value) (Value, error)
+		op    OpCode
+		lhs   interface{}
+		rhs   interface{}
+		want  ValueType
+	}{
+		{name: "Big Integer Subtract", apply: Arithmetic, op: OpSubtract, lhs: bigInt("18446744073709551617"), rhs: bigInt("18446744073709551616"), want: Integer},
+		{name: "Big Integer Add", apply: Arithmetic, op: OpAdd, lhs: bigInt("9223372036854775807"), rhs: int64(1), want: BigInt},
+		{name: "Big Integer Divide", apply: Arithmetic, op: OpIntegerDivide, lhs: bigInt("18446744073709551616"), rhs: int64(2), want: BigInt},
+		{name: "Big Integer Modulo", apply: Arithmetic, op: OpModulo, lhs: bigInt("18446744073709551617"), rhs: int64(4), want: Integer},
+		{name: "Big Integer And", apply: Bitwise, op: OpBitAnd, lhs: bigInt("18446744073709551617"), rhs: int64(255), want: Integer},
+		{name: "Big Integer Shift Right", apply: Bitwise, op: OpShiftRight, lhs: bigInt("18446744073709551616"), rhs: int64(2), want: Integer},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := tc.apply(tc.op, makeValue(tc.lhs), makeValue(tc.rhs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.ValueType != tc.want {
+				t.Errorf("got %s, want %s", v.TypeName(), Value{ValueType: tc.want}.TypeName())
+			}
+		})
+	}
+}
+
+func TestBitwise(t *testing.T) {
+	tcs := []struct {
+		name string
+		op   OpCode
+		lhs  interface{}
+		rhs  interface{}
+		want string
+		err  error
+	}{
+		{name: "And", op: OpBitAnd, lhs: int64(12), rhs: int64(10), want: "8"},
+		{name: "Or", op: OpBitOr, lhs: int64(12), rhs: int64(10), want: "14"},
+		{name: "Xor", op: OpBitXor, lhs: int64(12), rhs: int64(10), want: "6"},
+		{name: "Negative And", op: OpBitAnd, lhs: int64(-1), rhs: int64(255), want: "255"},
+		{name: "Big Integer Or", op: OpBitOr, lhs: bigInt("18446744073709551616"), rhs: int64(1), want: "18446744073709551617"},
+		{name: "Shift Left", op: OpShiftLeft, lhs: int64(1), rhs: int64(10), want: "1024"},
+		{name: "Shift Left Overflow", op: OpShiftLeft, lhs: int64(1), rhs: int64(64), want: "18446744073709551616"},
+		{name: "Shift Left Sign", op: OpShiftLeft, lhs: int64(-1), rhs: int64(63), want: "-9223372036854775808"},
+		{name: "Shift Right", op: OpShiftRight, lhs: int64(-16), rhs: int64(2), want: "-4"},
+		{name: "Shift Right All", op: OpShiftRight, lhs: int64(-16), rhs: int64(100), want: "-1"},
+		{name: "Big Integer Shift Right", op: OpShiftRight, lhs: bigInt("18446744073709551616"), rhs: int64(64), want: "1"},
+		{name: "Negative Shift", op: OpShiftLeft, lhs: int64(1), rhs: int64(-1), err: errNegativeShift},
+		{name: "Big Shift", op: OpShiftLeft, lhs: int64(1), rhs: bigInt("18446744073709551616"), err: errShiftTooLarge},
+		{name: "Shift Too Large", op: OpShiftLeft, lhs: int64(1), rhs: int64(100000000000), err: errShiftTooLarge},
+		{name: "Large Shift Of Zero", op: OpShiftLeft, lhs: int64(0), rhs: int64(100000000000), want: "0"},
+		{name: "Float Operand", op: OpBitAnd, lhs: 1.0, rhs: int64(1), err: errIntegerOperands},
+		{name: "Decimal Operand", op: OpShiftLeft, lhs: decimal("1"), rhs: int64(1), err: errIntegerOperands},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := Bitwise(tc.op, makeValue(tc.lhs), makeValue(tc.rhs))
+			if err != tc.err {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if err == nil && v.String() != tc.want {
+				t.Errorf("got %v, want %v", v, tc.want)
+			}
+		})
+	}
+}
+
+func TestComplement(t *testing.T) {
+	tcs := []struct {
+		name  string
+		value interface{}
+		want  string
+		err   error
+	}{
+		{name: "Integer", value: int64(5), want: "-6"},
+		{name: "Negative Integer", value: int64(-1), want: "0"},
+		{name: "Big Integer", value: bigInt("18446744073709551616"), want: "-18446744073709551617"},
+		{name: "Float", value: 1.0, err: errIntegerOperand},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := Complement(makeValue(tc.value))
+			if err != tc.err {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if err == nil && v.String() != tc.want {
+				t.Errorf("got %v, want %v", v, tc.want)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	xs := NewArray([]Value{makeValue(int64(1))})
+
+	tcs := []struct {
+		name string
+		lhs  interface{}
+		rhs  interface{}
+		want bool
+	}{
+		{name: "Integers", lhs: int64(42), rhs: int64(42), want: true},
+		{name: "Integer And Float", lhs: int64(42), rhs: 42.0, want: true},
+		{name: "Different Numbers", lhs: int64(42), rhs: 42.5, want: false},
+		{name: "Integer And Big Integer", lhs: int64(42), rhs: bigInt("42"), want: true},
+		{name: "Integer And Decimal", lhs: int64(42), rhs: decimal("42.0"), want: true},
+		{name: "Decimal And Float", lhs: decimal("0.5"), rhs: 0.5, want: true},
+		{name: "Inexact Float", lhs: decimal("0.1"), rhs: 0.1, want: false},
+		{name: "Big Integer And NaN", lhs: bigInt("1"), rhs: math.NaN(), want: false},
+		{name: "Integer And Float At 2^53", lhs: int64(9007199254740992), rhs: 9007199254740992.0, want: true},
+		{name: "Integer And Float Past 2^53", lhs: int64(9007199254740993), rhs: 9007199254740992.0, want: false},
+		{name: "Float And Integer Past 2^53", lhs: 9007199254740992.0, rhs: int64(9007199254740993), want: false},
+		{name: "Integer And 2^63", lhs: int64(math.MaxInt64), rhs: 9223372036854775808.0, want: false},
+		{name: "Same Array", lhs: xs, rhs: xs, want: true},
+		{name: "Equal Arrays", lhs: xs, rhs: []Value{makeValue(int64(1))}, want: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			equal, err := Equal(makeValue(tc.lhs), makeValue(tc.rhs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if equal != tc.want {
+				t.Errorf("got %v, want %v", equal, tc.want)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	xs := []Value{makeValue(int64(1)), makeValue("a"), makeValue(2.5)}
+
+	tcs := []struct {
+		name      string
+		container interface{}
+		v         interface{}
+		want      bool
+		err       error
+	}{
+		{name: "Array", container: xs, v: "a", want: true},
+		{name: "Array Number", container: xs, v: decimal("2.5"), want: true},
+		{name: "Array Missing", container: xs, v: int64(2), want: false},
+		{name: "Empty Array", container: []Value{}, v: int64(1), want: false},
+		{name: "Substring", container: "Maki", v: "ak", want: true},
+		{name: "Missing Substring", container: "Maki", v: "ka", want: false},
+		{name: "Integer In String", container: "Maki", v: int64(1), err: errInvalidOperands},
+		{name: "Not A Container", container: int64(12), v: int64(1), err: errNotContainer},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := Contains(makeValue(tc.container), makeValue(tc.v))
+			if err != tc.err {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if err == nil && v.Boolean != tc.want {
+				t.Errorf("got %v, want %v", v.Boolean, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tcs := []struct {
+		name string
+		op   OpCode
+		lhs  interface{}
+		rhs  interface{}
+		want bool
+	}{
+		{name: "Integers", op: OpLess, lhs: int64(1), rhs: int64(2), want: true},
+		{name: "Big Integers", op: OpGreater, lhs: bigInt("100000000000000000000"), rhs: bigInt("99999999999999999999"), want: true},
+		{name: "Decimal And Integer", op: OpLessEqual, lhs: decimal("2.01"), rhs: int64(2), want: false},
+		{name: "Big Integer And Infinity", op: OpLess, lhs: bigInt("100000000000000000000"), rhs: math.Inf(1), want: true},
+		{name: "Negative Infinity And Decimal", op: OpGreaterEqual, lhs: math.Inf(-1), rhs: decimal("-1"), want: false},
+		{name: "Decimal And NaN", op: OpLess, lhs: decimal("1"), rhs: math.NaN(), want: false},
+		{name: "Integer Past 2^53", op: OpGreater, lhs: int64(9007199254740993), rhs: 9007199254740992.0, want: true},
+		{name: "Float Below Integer Past 2^53", op: OpLess, lhs: 9007199254740992.0, rhs: int64(9007199254740993), want: true},
+		{name: "Integer And Fraction", op: OpLess, lhs: int64(-3), rhs: -2.5, want: true},
+		{name: "Integer And 2^63", op: OpLess, lhs: int64(math.MaxInt64), rhs: 9223372036854775808.0, want: true},
+		{name: "Integer And Infinity", op: OpGreater, lhs: int64(math.MinInt64), rhs: math.Inf(-1), want: true},
+		{name: "Integer And NaN", op: OpGreaterEqual, lhs: int64(1), rhs: math.NaN(), want: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := Compare(tc.op, makeValue(tc.lhs), makeValue(tc.rhs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Boolean != tc.want {
+				t.Errorf("got %v, want %v", v.Boolean, tc.want)
+			}
+		})
+	}
+}
+
+func TestNegate(t *testing.T) {
+	tcs := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "Integer", value: int64(42), want: "-42"},
+		{name: "Minimum Integer", value: int64(math.MinInt64), want: "9223372036854775808"},
+		{name: "Big Integer", value: bigInt("-100000000000000000000"), want: "100000000000000000000"},
+		{name: "Decimal", value: decimal("0.01"), want: "-0.01"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := Negate(makeValue(tc.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.String() != tc.want {
+				t.Errorf("got %v, want %v", v, tc.want)
+			}
+		})
+	}
+}
+
+func TestConcat(t *testing.T) {
+	values := []Value{
+		NewString("x = "),
+		makeValue(int64(1)),
+		{ValueType: Nil},
+		makeValue([]Value{makeValue(2.5), makeValue(true)}),
+		makeValue([]Value{}),
+	}
+
+	want := NewString("x = 1nil[ 2.5, true ][]")
+	if got := Concat(values); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestValue_String(t *testing.T) {
+	tcs := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "Integer", value: int64(3), want: "3"},
+		{name: "Negative Integer", value: int64(-3), want: "-3"},
+		{name: "Float", value: 3.14, want: "3.14"},
+		{name: "Whole Float", value: 3.0, want: "3.0"},
+		{name: "Large Float", value: 1e21, want: "1e+21"},
+		{name: "Small Float", value: 1e-7, want: "1e-07"},
+		{name: "Infinity", value: math.Inf(-1), want: "-Inf"},
+		{name: "Big Integer", value: bigInt("-123456789012345678901234567890"), want: "-123456789012345678901234567890"},
+		{name: "Decimal", value: decimal("10.50"), want: "10.5"},
+		{name: "Whole Decimal", value: decimal("10"), want: "10.0"},
+		{name: "Small Decimal", value: decimal("0.000000000000000000000000000000001"), want: "0.000000000000000000000000000000001"},
+		{name: "Repeating Decimal", value: decimal("1/3"), want: "0.3333333333333333333333333333"},
+		{name: "Rounded Decimal", value: decimal("29999999999999999999999999999999/30000000000000000000000000000000"), want: "1.0"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := makeValue(tc.value).String(); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -30,35 +30,51 @@ const (
 	OpAdd OpCode = iota
 	OpArray
 	OpAssert
+	OpBitAnd
+	OpBitNot
+	OpBitOr
+	OpBitXor
 	OpDefineGlobal
 	OpDivide
+	OpDuplicate
+	OpDuplicatePair
 	OpCall
+	OpConcat
 	OpEqualEqual
+	OpFalse
 	OpGetGlobal
-	OpGetGlobalIndex
 	OpGetLocal
-	OpGetLocalIndex
+	OpGetProperty
 	OpGreater
 	OpGreaterEqual
+	OpIn
+	OpIndexGet
+	OpIndexSet
+	OpIntegerDivide
 	OpJump
 	OpJumpIfFalse
 	OpLess
 	OpLessEqual
 	OpLoop
 	OpMinus
+	OpModulo
 	OpMultiply
 	OpNil
 	OpNot
 	OpNotEqual
 	OpPop
+	OpPower
 	OpPrint
 	OpReturn
+	OpRotate
 	OpSetGlobal
-	OpSetGlobalIndex
 	OpSetLocal
-	OpSetLocalIndex
+	OpShiftLeft
+	OpShiftRight
+	OpSlice
 	OpSubtract
 	OpTerminate
+	OpTrue
 	OpValue
 )
 
@@ -66,24 +82,50 @@ func (op OpCode) String() string {
 	switch op {
 	case OpAdd:
 		return "OP_ADD"
+	case OpAssert:
+		return "OP_ASSERT"
+	case OpBitAnd:
+		return "OP_BIT_AND"
+	case OpBitNot:
+		return "OP_BIT_NOT"
+	case OpBitOr:
+		return "OP_BIT_OR"
+	case OpBitXor:
+		return "OP_BIT_XOR"
 	case OpCall:
 		return "OP_CALL"
+	case OpConcat:
+		return "OP_CONCAT"
 	case OpDefineGlobal:
 		return "OP_DEFINE_GLOBAL"
+	case OpDivide:
+		return "OP_DIVIDE"
+	case OpDuplicate:
+		return "OP_DUPLICATE"
+	case OpDuplicatePair:
+		return "OP_DUPLICATE_PAIR"
 	case OpEqualEqual:
 		return "OP_EQUAL_EQUAL"
+	case OpFalse:
+		return "OP_FALSE"
 	case OpGetGlobal:
 		return "OP_GET_GLOBAL"
-	case OpGetGlobalIndex:
-		return "OP_GET_GLOBAL_INDEX"
 	case OpGetLocal:
 		return "OP_GET_LOCAL"
-	case OpGetLocalIndex:
-		return "OP_GET_LOCAL_INDEX"
+	case OpGetProperty:
+		return "OP_GET_PROPERTY"
 	case OpGreater:
 		return "OP_GREATER"
 	case OpGreaterEqual:
 		return "OP_GREATER_EQUAL"
+	case OpIn:
+		return "OP_IN"
+	case OpIndexGet:
+		return "OP_INDEX_GET"
+	case OpIndexSet:
+		return "OP_INDEX_SET"
+	case OpIntegerDivide:
+		return "OP_INTEGER_DIVIDE"
 	case OpJump:
 		return "OP_JUMP"
 	case OpJumpIfFalse:
@@ -96,30 +138,44 @@ func (op OpCode) String() string {
 		return "OP_LOOP"
 	case OpMinus:
 		return "OP_MINUS"
+	case OpModulo:
+		return "OP_MODULO"
 	case OpMultiply:
 		return "OP_MULTIPLY"
+	case OpNil:
+		return "OP_NIL"
+	case OpNot:
+		return "OP_NOT"
 	case OpNotEqual:
 		return "OP_NOT_EQUAL"
 	case OpArray:
 		return "OP_ARRAY"
 	case OpSetGlobal:
 		return "OP_SET_GLOBAL"
-	case OpSetGlobalIndex:
-		return "OP_SET_GLOBAL_INDEX"
 	case OpSetLocal:
 		return "OP_SET_LOCAL"
-	case OpSetLocalIndex:
-		return "OP_SET_LOCAL_INDEX"
+	case OpShiftLeft:
+		return "OP_SHIFT_LEFT"
+	case OpShiftRight:
+		return "OP_SHIFT_RIGHT"
+	case OpSlice:
+		return "OP_SLICE"
 	case OpSubtract:
 		return "OP_SUBTRACT"
 	case OpPop:
 		return "OP_POP"
+	case OpPower:
+		return "OP_POWER"
 	case OpPrint:
 		return "OP_PRINT"
 	case OpReturn:
 		return "OP_RETURN"
+	case OpRotate:
+		return "OP_ROTATE"
 	case OpTerminate:
 		return "OP_TERMINATE"
+	case OpTrue:
+		return "OP_TRUE"
 	case OpValue:
 		return "OP_VALUE"
 	default:
@@ -127,10 +183,28 @@ func (op OpCode) String() string {
 	}
 }
 
+// Operands returns the number of bytes following op in code.
+func (op OpCode) Operands() int {
+	switch op {
+	case OpArray, OpCall, OpConcat, OpDefineGlobal, OpJump, OpJumpIfFalse, OpLoop, OpValue:
+		return 1
+	case OpGetGlobal, OpGetLocal, OpGetProperty:
+		return 1
+	case OpSetGlobal, OpSetLocal:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// PCode holds the code of a function, its constants and the line table,
+// that is the span of source code each byte is compiled from.
 type PCode struct {
 	Code      []OpCode
 	Constants *array
 	Lines     *RLE
+	Columns   *RLE
+	Lengths   *RLE
 }
 
 func NewPCode() *PCode {
@@ -138,27 +212,48 @@ func NewPCode() *PCode {
 		Code:      make([]OpCode, 0, 8),
 		Constants: newArray(),
 		Lines:     NewRLE(),
+		Columns:   NewRLE(),
+		Lengths:   NewRLE(),
 	}
 }
 
-func (c *PCode) Write(op OpCode, line int) {
+func (c *PCode) Write(op OpCode, span Span) {
 	c.Code = append(c.Code, op)
-	c.Lines.Add(line)
+	c.Lines.Add(span.Line)
+	c.Columns.Add(span.Column)
+	c.Lengths.Add(span.Length)
 }
 
-func (c *PCode) WriteConstant(v Value, line int) {
-	c.Write(OpValue, line)
+func (c *PCode) WriteConstant(v Value, span Span) {
+	c.Write(OpValue, span)
 	address := c.Constants.Write(v)
-	c.Write(OpCode(address), line)
+	c.Write(OpCode(address), span)
 }
 
-func (c *PCode) WriteIdentifier(identifier string, line int) {
-	v := Value{ValueType: Object, Ptr: identifier}
-	address := c.Constants.Write(v)
-	c.Write(OpCode(address), line)
+// Span returns the span of source code the byte at address is compiled from.
+func (c *PCode) Span(address int) (Span, error) {
+	line, err := c.Lines.At(address)
+	if err != nil {
+		return Span{}, err
+	}
+	column, err := c.Columns.At(address)
+	if err != nil {
+		return Span{}, err
+	}
+	length, err := c.Lengths.At(address)
+	if err != nil {
+		return Span{}, err
+	}
+	return Span{Line: line, Column: column, Length: length}, nil
 }
 
 func (c PCode) String() string {
+	return c.disassemble(nil)
+}
+
+// disassemble returns the code in readable form, global variables are named
+// after symbols if it is not nil.
+func (c PCode) disassemble(symbols *Symbols) string {
 	var s strings.Builder
 	fs := make([]*Function, 0)
 
@@ -179,12 +274,12 @@ func (c PCode) String() string {
 
 		// Skip next code
 		switch c.Code[i] {
-		case OpCall, OpArray:
+		case OpCall, OpArray, OpConcat:
 			{
 				i++
 				s.WriteString(fmt.Sprintf(" #%d", int(c.Code[i])))
 			}
-		case OpValue, OpDefineGlobal:
+		case OpValue:
 			{
 				i++
 				v := c.Constants.At(int(c.Code[i]))
@@ -203,11 +298,19 @@ func (c PCode) String() string {
 					}
 				}
 			}
-		case OpGetGlobal, OpSetGlobal, OpGetGlobalIndex, OpSetGlobalIndex:
+		case OpGetProperty:
 			{
 				i++
-				v := c.Constants.At(int(c.Code[i]))
-				s.WriteString(fmt.Sprintf(" '%s'", v))
+				s.WriteString(fmt.Sprintf(" '%s'", c.Constants.At(int(c.Code[i]))))
+			}
+		case OpDefineGlobal, OpGetGlobal, OpSetGlobal:
+			{
+				i++
+				if slot := int(c.Code[i]); symbols != nil && slot < symbols.Len() {
+					s.WriteString(fmt.Sprintf(" '%s'", symbols.Name(slot)))
+				} else {
+					s.WriteString(fmt.Sprintf(" #%d", slot))
+				}
 			}
 		case OpGetLocal, OpSetLocal:
 			{
@@ -233,7 +336,7 @@ func (c PCode) String() string {
 
 	for _, f := range fs {
 		s.WriteString("\n__" + f.Name + "__\n")
-		s.WriteString(f.PCode.String())
+		s.WriteString(f.PCode.disassemble(f.Symbols))
 	}
 
 	return s.String()
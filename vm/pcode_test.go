@@ -1,6 +1,9 @@
 package vm
 
-import "testing"
+import (
+	"math/big"
+	"testing"
+)
 
 func makeValue(i interface{}) Value {
 	value := Value{}
@@ -11,11 +14,26 @@ func makeValue(i interface{}) Value {
 			value.ValueType = Bool
 			value.Boolean = v
 		}
+	case int64:
+		{
+			value.ValueType = Integer
+			value.Int = v
+		}
 	case float64:
 		{
 			value.ValueType = Number
 			value.Float = v
 		}
+	case *big.Int:
+		value = NewBigInt(v)
+	case *big.Rat:
+		value = NewDecimal(v)
+	case string:
+		value = NewString(v)
+	case []Value:
+		value = NewArray(v)
+	case Value:
+		value = v
 	}
 
 	return value
@@ -0,0 +1,54 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Span locates in the source code the token an instruction is compiled from.
+type Span struct {
+	Line   int
+	Column int
+	Length int
+}
+
+// Snippet returns the source line of span with a marker under it, e.g.
+//
+//	3 | print (1 + 2
+//	  |             ^
+//
+// An empty string is returned if span is not in source.
+func Snippet(source string, span Span) string {
+	lines := strings.Split(source, "\n")
+	if span.Line < 1 || span.Line > len(lines) {
+		return ""
+	}
+
+	line := []rune(strings.TrimRight(lines[span.Line-1], "\r"))
+	if span.Column < 1 || span.Column > len(line)+1 {
+		return ""
+	}
+
+	// keep tabs so that the marker is aligned
+	var padding strings.Builder
+	for _, r := range line[:span.Column-1] {
+		if r == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	// the marker doesn't go beyond the line
+	length := span.Length
+	if rest := len(line) - span.Column + 1; length > rest {
+		length = rest
+	}
+	if length < 1 {
+		length = 1
+	}
+
+	gutter := fmt.Sprintf("%4d | ", span.Line)
+	return fmt.Sprintf("%s%s\n%s%s^%s", gutter, string(line),
+		strings.Repeat(" ", len(gutter)-2)+"| ", padding.String(), strings.Repeat("~", length-1))
+}
@@ -0,0 +1,57 @@
+package vm
+
+import "testing"
+
+func TestSnippet(t *testing.T) {
+	tcs := []struct {
+		name   string
+		source string
+		span   Span
+		output string
+	}{
+		{
+			name:   "Happy Path",
+			source: "var x = 1\nprint x + y\n",
+			span:   Span{Line: 2, Column: 11, Length: 1},
+			output: "   2 | print x + y\n     |           ^",
+		},
+		{
+			name:   "Long Token",
+			source: "print unknown",
+			span:   Span{Line: 1, Column: 7, Length: 7},
+			output: "   1 | print unknown\n     |       ^~~~~~~",
+		},
+		{
+			name:   "Marker Within Line",
+			source: "print \"unterminated\nstring",
+			span:   Span{Line: 1, Column: 7, Length: 20},
+			output: "   1 | print \"unterminated\n     |       ^~~~~~~~~~~~~",
+		},
+		{
+			name:   "Tabs",
+			source: "\t\tprint x",
+			span:   Span{Line: 1, Column: 9, Length: 1},
+			output: "   1 | \t\tprint x\n     | \t\t      ^",
+		},
+		{
+			name:   "End Of Line",
+			source: "print (",
+			span:   Span{Line: 1, Column: 8, Length: 0},
+			output: "   1 | print (\n     |        ^",
+		},
+		{
+			name:   "Out Of Source",
+			source: "print 42",
+			span:   Span{Line: 3, Column: 1, Length: 1},
+			output: "",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Snippet(tc.source, tc.span); got != tc.output {
+				t.Errorf("got %q, want %q", got, tc.output)
+			}
+		})
+	}
+}
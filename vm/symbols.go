@@ -0,0 +1,53 @@
+package vm
+
+// Symbols is the table of the global variables of a program: the compiler
+// gives each name a slot, where the VM stores its value. The functions
+// compiled together share the same table, which grows as new code refers to
+// new names, like the lines of the REPL do.
+type Symbols struct {
+	names []string
+	slots map[string]int
+}
+
+func NewSymbols() *Symbols {
+	return &Symbols{
+		names: make([]string, 0, 8),
+		slots: make(map[string]int),
+	}
+}
+
+// Slot returns the slot of name, adding it to the table if missing.
+func (s *Symbols) Slot(name string) int {
+	if slot, ok := s.slots[name]; ok {
+		return slot
+	}
+
+	s.names = append(s.names, name)
+	s.slots[name] = len(s.names) - 1
+	return len(s.names) - 1
+}
+
+// Lookup returns the slot of name, if it has one.
+func (s *Symbols) Lookup(name string) (int, bool) {
+	slot, ok := s.slots[name]
+	return slot, ok
+}
+
+// Name returns the name of the global variable stored in slot.
+func (s *Symbols) Name(slot int) string {
+	return s.names[slot]
+}
+
+// Truncate drops the names given a slot after the first n, like those of
+// code that failed to compile.
+func (s *Symbols) Truncate(n int) {
+	for _, name := range s.names[n:] {
+		delete(s.slots, name)
+	}
+	s.names = s.names[:n]
+}
+
+// Len returns the number of slots.
+func (s *Symbols) Len() int {
+	return len(s.names)
+}
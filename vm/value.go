@@ -2,27 +2,62 @@ package vm
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
 type ValueType uint8
 
 const (
 	Array ValueType = iota
+	BigInt
 	Bool
+	Decimal
+	Integer
 	Nil
 	Number
 	Object
-	Reference
+	String
 )
 
 type Value struct {
 	ValueType
 	Boolean bool
+	Int     int64
 	Float   float64
 	Ptr     interface{}
 }
 
+// NewBigInt returns a big integer value, n must not be modified afterwards.
+func NewBigInt(n *big.Int) Value {
+	return Value{ValueType: BigInt, Ptr: n}
+}
+
+// NewArray returns an array holding values. Arrays are references: the
+// elements live on the heap and are shared by the copies of the value, so
+// that assigning an array or passing it to a function does not copy it and
+// the array can grow in place.
+func NewArray(values []Value) Value {
+	return Value{ValueType: Array, Ptr: &values}
+}
+
+// elements returns the elements of an array.
+func (v Value) elements() *[]Value {
+	return v.Ptr.(*[]Value)
+}
+
+// NewString returns a string value.
+func NewString(s string) Value {
+	return Value{ValueType: String, Ptr: s}
+}
+
+// NewDecimal returns a decimal value, r must not be modified afterwards.
+func NewDecimal(r *big.Rat) Value {
+	return Value{ValueType: Decimal, Ptr: r}
+}
+
 func (v Value) BoolValue() bool {
 	if v.ValueType == Bool && v.Boolean {
 		return true
@@ -30,42 +65,163 @@ func (v Value) BoolValue() bool {
 	return false
 }
 
-func (v Value) String() string {
+// TypeName returns the name of the value type as seen by Maki programs.
+func (v Value) TypeName() string {
 	switch v.ValueType {
 	case Array:
+		return "array"
+	case BigInt:
+		return "bigint"
+	case Bool:
+		return "bool"
+	case Decimal:
+		return "decimal"
+	case Integer:
+		return "int"
+	case Nil:
+		return "nil"
+	case Number:
+		return "float"
+	case Object:
 		{
-			values, ok := v.Ptr.([]Value)
-			if !ok {
-				return fmt.Sprintf("Invalid array content :: Value: %v", v.Ptr)
-			}
-			s := values[0].String()
-			for _, v := range values[1:] {
-				s += ", " + v.String()
+			switch v.Ptr.(type) {
+			case *Function:
+				return "function"
+			case Native:
+				return "native"
+			case *method:
+				return "method"
 			}
-			return "[ " + s + " ]"
+			return "object"
 		}
+	case String:
+		return "string"
+	}
+	return "unknown"
+}
+
+func (v Value) String() string {
+	if v.ValueType == Array {
+		return v.format(make(map[*[]Value]bool))
+	}
+	return v.scalar()
+}
+
+// format returns the string of an array whose elements may be arrays, seen
+// holding the arrays being formatted: an array containing itself is shown as
+// [...] where it appears again.
+func (v Value) format(seen map[*[]Value]bool) string {
+	if v.ValueType != Array {
+		return v.scalar()
+	}
+
+	values, ok := v.Ptr.(*[]Value)
+	if !ok {
+		return fmt.Sprintf("Invalid array content :: Value: %v", v.Ptr)
+	}
+	if seen[values] {
+		return "[...]"
+	}
+	if len(*values) == 0 {
+		return "[]"
+	}
+
+	seen[values] = true
+	defer delete(seen, values)
+	s := (*values)[0].format(seen)
+	for _, v := range (*values)[1:] {
+		s += ", " + v.format(seen)
+	}
+	return "[ " + s + " ]"
+}
+
+func (v Value) scalar() string {
+	switch v.ValueType {
+	case BigInt:
+		return v.Ptr.(*big.Int).String()
 	case Bool:
 		return strconv.FormatBool(v.Boolean)
+	case Decimal:
+		return formatDecimal(v.Ptr.(*big.Rat))
 	case Nil:
 		return "nil"
+	case Integer:
+		return strconv.FormatInt(v.Int, 10)
 	case Number:
-		return strconv.FormatFloat(v.Float, 'f', 0, 64)
+		return formatFloat(v.Float)
 	case Object:
 		{
 			switch value := v.Ptr.(type) {
-			case string:
-				return value
 			case *Function:
 				return value.Name
-			case *Native:
+			case Native:
 				return "<native fun>"
+			case *method:
+				return "<method " + value.name + ">"
 			}
 		}
-	case Reference:
-		{
-			v, _ := v.Ptr.(Value)
-			return v.String()
-		}
+	case String:
+		return v.Ptr.(string)
 	}
 	return fmt.Sprintf("UnknownValue :: ValueType=%d", v.ValueType)
 }
+
+// formatFloat returns the shortest representation of f that reads back to
+// the same float, with a decimal point so that it is not taken for an
+// integer.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if math.IsInf(f, 0) || math.IsNaN(f) || strings.ContainsAny(s, ".e") {
+		return s
+	}
+	return s + ".0"
+}
+
+// decimalDigits is the number of digits printed after the decimal point of
+// the decimals that cannot be written exactly, like 1/3.
+const decimalDigits = 28
+
+// formatDecimal returns the digits of r, exactly when r has a finite number of
+// them, with a decimal point like formatFloat does.
+func formatDecimal(r *big.Rat) string {
+	digits, exact := fractionDigits(r.Denom())
+	if !exact {
+		// rounding may leave trailing zeros
+		s := strings.TrimRight(r.FloatString(decimalDigits), "0")
+		if strings.HasSuffix(s, ".") {
+			s += "0"
+		}
+		return s
+	}
+	if digits == 0 {
+		return r.FloatString(0) + ".0"
+	}
+	return r.FloatString(digits)
+}
+
+// fractionDigits returns the number of digits after the decimal point of the
+// fractions with denominator d, it returns false if they never end, that is
+// when d has prime factors other than 2 and 5.
+func fractionDigits(d *big.Int) (int, bool) {
+	twos := int(d.TrailingZeroBits())
+	n := new(big.Int).Rsh(d, uint(twos))
+
+	fives := 0
+	five, m := big.NewInt(5), new(big.Int)
+	for {
+		q, r := new(big.Int).QuoRem(n, five, m)
+		if r.Sign() != 0 {
+			break
+		}
+		n = q
+		fives++
+	}
+
+	if n.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
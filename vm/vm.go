@@ -1,7 +1,11 @@
 package vm
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
 )
 
 const (
@@ -22,26 +26,130 @@ func newFrame(fun *Function) Frame {
 	}
 }
 
+// Error is a runtime error raised executing the instruction compiled from Span.
+type Error struct {
+	Span
+	Message string
+	Source  string // source code of the function raising the error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("maki :: runtime error, %s [line %d:%d]", e.Message, e.Line, e.Column)
+}
+
+// global is the value stored in a slot, slots are made before the variable
+// is defined.
+type global struct {
+	Value
+	defined bool
+}
+
 type VM struct {
+	op      int // address of the instruction being executed
 	ip      int // instruction pointer
 	sp      int // stack pointer
 	fp      int // frame pointer
 	stack   [StackSize]Value
 	frames  [FrameSize]Frame
-	globals map[string]Value
+	globals []global
+	symbols *Symbols // names of the global slots
+	natives map[string]Value
+	stdin   *bufio.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+// Option configures a VM created by NewVM.
+type Option func(*VM)
+
+// Stdin sets the reader used by natives reading user input.
+func Stdin(r io.Reader) Option {
+	return func(vm *VM) {
+		vm.stdin = bufio.NewReader(r)
+	}
 }
 
-func NewVM() *VM {
+// Stdout sets the writer used by print statement and natives.
+func Stdout(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.stdout = w
+	}
+}
+
+// Stderr sets the writer used for error reporting.
+func Stderr(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.stderr = w
+	}
+}
+
+func NewVM(options ...Option) *VM {
 	vm := &VM{
-		globals: make(map[string]Value, GlobalSize),
+		globals: make([]global, 0, GlobalSize),
+		natives: make(map[string]Value),
+		stdin:   bufio.NewReader(os.Stdin),
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+	}
+
+	for _, option := range options {
+		option(vm)
 	}
 
 	vm.defineNative("println", Println{})
+	vm.defineNative("readln", Readln{})
 	vm.defineNative("clock", Clock{})
+	vm.defineNative("bigint", ToBigInt{})
+	vm.defineNative("decimal", ToDecimal{})
+	vm.defineNative("len", Len{})
+	vm.defineNative("copy", Copy{})
 
 	return vm
 }
 
+// Globals returns a copy of the global variables, natives included.
+func (vm *VM) Globals() map[string]Value {
+	globals := make(map[string]Value, len(vm.natives)+len(vm.globals))
+	for name, v := range vm.natives {
+		globals[name] = v
+	}
+	for slot, g := range vm.globals {
+		if g.defined {
+			globals[vm.symbols.Name(slot)] = g.Value
+		}
+	}
+	return globals
+}
+
+// bind makes room for the global variables of symbols, the ones named after
+// a native are bound to it. The variables defined with another table keep
+// their value, moved to the slots of the same names in symbols.
+func (vm *VM) bind(symbols *Symbols) {
+	if symbols == nil {
+		return
+	}
+
+	var moved map[int]global
+	if symbols != vm.symbols {
+		moved = make(map[int]global)
+		for slot, g := range vm.globals {
+			if g.defined {
+				moved[symbols.Slot(vm.symbols.Name(slot))] = g
+			}
+		}
+		vm.symbols = symbols
+		vm.globals = vm.globals[:0]
+	}
+
+	for slot := len(vm.globals); slot < symbols.Len(); slot++ {
+		native, ok := vm.natives[symbols.Name(slot)]
+		vm.globals = append(vm.globals, global{Value: native, defined: ok})
+	}
+	for slot, g := range moved {
+		vm.globals[slot] = g
+	}
+}
+
 func (vm *VM) initPointers() {
 	vm.ip = 0
 	vm.sp = 0
@@ -49,7 +157,7 @@ func (vm *VM) initPointers() {
 }
 
 func (vm *VM) defineNative(name string, native Native) {
-	vm.globals[name] = Value{
+	vm.natives[name] = Value{
 		ValueType: Object,
 		Ptr:       native,
 	}
@@ -96,19 +204,22 @@ func (vm *VM) readByte() OpCode {
 func (vm *VM) Run(fun *Function) error {
 	defer func() {
 		if err := recover(); err != nil {
-			fmt.Printf("maki :: panic at ip %04d\n\n", vm.ip)
+			_, _ = fmt.Fprintf(vm.stderr, "maki :: panic at ip %04d\n\n", vm.ip)
 			panic(err)
 		}
 	}()
 
 	vm.initPointers()
+	vm.bind(fun.Symbols)
 	vm.pushFrame(newFrame(fun))
 
 	for {
+		vm.op = vm.ip
+
 		switch op := vm.readByte(); op {
-		case OpAdd:
+		case OpAdd, OpDivide, OpIntegerDivide, OpModulo, OpMultiply, OpPower, OpSubtract:
 			{
-				if err := vm.add(); err != nil {
+				if err := vm.arithmetic(op); err != nil {
 					return err
 				}
 			}
@@ -128,6 +239,10 @@ func (vm *VM) Run(fun *Function) error {
 					return err
 				}
 			}
+		case OpConcat:
+			{
+				vm.concat()
+			}
 		case OpValue:
 			{
 				vm.constant()
@@ -136,37 +251,31 @@ func (vm *VM) Run(fun *Function) error {
 			{
 				vm.defineGlobal()
 			}
-		case OpDivide:
-			{
-				vm.divide()
-			}
 		case OpEqualEqual, OpNotEqual:
 			{
 				if err := vm.equality(op); err != nil {
 					return err
 				}
 			}
-		case OpGetGlobal:
+		case OpFalse:
 			{
-				if err := vm.getGlobal(false); err != nil {
-					return err
-				}
+				vm.boolean(false)
 			}
-		case OpGetGlobalIndex:
+		case OpGetGlobal:
 			{
-				if err := vm.getGlobal(true); err != nil {
+				if err := vm.getGlobal(); err != nil {
 					return err
 				}
 			}
 		case OpGetLocal:
 			{
-				if err := vm.getLocal(false); err != nil {
+				if err := vm.getLocal(); err != nil {
 					return err
 				}
 			}
-		case OpGetLocalIndex:
+		case OpGetProperty:
 			{
-				if err := vm.getLocal(true); err != nil {
+				if err := vm.getProperty(); err != nil {
 					return err
 				}
 			}
@@ -176,6 +285,24 @@ func (vm *VM) Run(fun *Function) error {
 					return err
 				}
 			}
+		case OpIn:
+			{
+				if err := vm.membership(); err != nil {
+					return err
+				}
+			}
+		case OpIndexGet:
+			{
+				if err := vm.indexGet(); err != nil {
+					return err
+				}
+			}
+		case OpIndexSet:
+			{
+				if err := vm.indexSet(); err != nil {
+					return err
+				}
+			}
 		case OpJump:
 			{
 				vm.jump()
@@ -202,17 +329,43 @@ func (vm *VM) Run(fun *Function) error {
 					return err
 				}
 			}
-		case OpMultiply:
+		case OpBitAnd, OpBitOr, OpBitXor, OpShiftLeft, OpShiftRight:
 			{
-				vm.multiply()
+				if err := vm.bitwise(op); err != nil {
+					return err
+				}
+			}
+		case OpBitNot:
+			{
+				if err := vm.complement(); err != nil {
+					return err
+				}
+			}
+		case OpDuplicate:
+			{
+				vm.push(*vm.top())
+			}
+		case OpDuplicatePair:
+			{
+				// the object and the index of an element being updated
+				vm.push(vm.stack[vm.sp-2])
+				vm.push(vm.stack[vm.sp-2])
 			}
 		case OpPop:
 			{
 				_ = vm.pop()
 			}
+		case OpRotate:
+			{
+				// the value on top goes under the object and the index of an
+				// element, to be left once the element is updated
+				top := vm.stack[vm.sp-1]
+				copy(vm.stack[vm.sp-2:vm.sp], vm.stack[vm.sp-3:vm.sp-1])
+				vm.stack[vm.sp-3] = top
+			}
 		case OpPrint:
 			{
-				fmt.Printf("%+v\n", vm.pop())
+				_, _ = fmt.Fprintf(vm.stdout, "%+v\n", vm.pop())
 			}
 		case OpReturn:
 			{
@@ -220,71 +373,74 @@ func (vm *VM) Run(fun *Function) error {
 			}
 		case OpSetGlobal:
 			{
-				if err := vm.setGlobal(false); err != nil {
-					return err
-				}
-			}
-		case OpSetGlobalIndex:
-			{
-				if err := vm.setGlobal(true); err != nil {
+				if err := vm.setGlobal(); err != nil {
 					return err
 				}
 			}
 		case OpSetLocal:
 			{
-				if err := vm.setLocal(false); err != nil {
+				if err := vm.setLocal(); err != nil {
 					return err
 				}
 			}
-		case OpSetLocalIndex:
+		case OpSlice:
 			{
-				if err := vm.setLocal(true); err != nil {
+				if err := vm.slice(); err != nil {
 					return err
 				}
 			}
-		case OpSubtract:
-			{
-				vm.subtract()
-			}
 		case OpTerminate:
 			{
 				return nil
 			}
+		case OpTrue:
+			{
+				vm.boolean(true)
+			}
 		default:
 			{
-				return fmt.Errorf("maki :: runtime error, op code %04d not yet implemented", vm.peekByte())
+				return vm.error("op code %04d not yet implemented", op)
 			}
 		}
 	}
 }
 
-func (vm *VM) add() error {
-	rhs, lhs := vm.getOperands()
-	err := fmt.Errorf("maki :: runtime error, invalid binary operands [line %d]", vm.getCurrentLine())
-
-	if lhs.ValueType == Number && rhs.ValueType == Number {
-		v := Value{ValueType: Number, Float: lhs.Float + rhs.Float}
-		vm.push(v)
-		return nil
+// Eval runs fun as Run does, returning the value it leaves on top of the
+// stack, as compiled expressions do, or nil.
+func (vm *VM) Eval(fun *Function) (Value, error) {
+	if err := vm.Run(fun); err != nil {
+		return Value{ValueType: Nil}, err
 	}
 
-	if lhs.ValueType == Object && rhs.ValueType == Object {
-		ls, ok := lhs.Ptr.(string)
-		if !ok {
-			return err
-		}
+	if vm.sp == 0 {
+		return Value{ValueType: Nil}, nil
+	}
+	return vm.pop(), nil
+}
 
-		rs, ok := rhs.Ptr.(string)
-		if !ok {
-			return err
-		}
+func (vm *VM) arithmetic(op OpCode) error {
+	rhs, lhs := vm.getOperands()
+	v, err := Arithmetic(op, lhs, rhs)
+	if err != nil {
+		return vm.error("%s", err)
+	}
+	vm.push(v)
+	return nil
+}
 
-		v := Value{ValueType: Object, Ptr: ls + rs}
-		vm.push(v)
-		return nil
+func (vm *VM) bitwise(op OpCode) error {
+	rhs, lhs := vm.getOperands()
+	v, err := Bitwise(op, lhs, rhs)
+	if err != nil {
+		return vm.error("%s", err)
 	}
+	vm.push(v)
+	return nil
+}
 
-	return err
+func (vm *VM) boolean(b bool) {
+	v := Value{ValueType: Bool, Boolean: b}
+	vm.push(v)
 }
 
 func (vm *VM) call() error {
@@ -296,7 +452,7 @@ func (vm *VM) call() error {
 	v := vm.pop()
 
 	if v.ValueType != Object {
-		return fmt.Errorf("maki :: runtime error, %s is not callable [line %d]", v.String(), vm.getCurrentLine())
+		return vm.error("%s is not callable", v.String())
 	}
 
 	if v.ValueType == Object {
@@ -315,12 +471,23 @@ func (vm *VM) call() error {
 			}
 		case Native:
 			{
-				v := f.Function(args)
+				v, err := f.Function(vm, args)
+				if err != nil {
+					return vm.error("%s", err)
+				}
+				vm.push(v)
+			}
+		case *method:
+			{
+				v, err := f.call(args)
+				if err != nil {
+					return vm.error("%s", err)
+				}
 				vm.push(v)
 			}
 		default:
 			{
-				return fmt.Errorf("maki :: runtime error, %s is not callable [line %d]", v.String(), vm.getCurrentLine())
+				return vm.error("%s is not callable", v.String())
 			}
 		}
 	}
@@ -340,130 +507,193 @@ func (vm *VM) constant() {
 }
 
 func (vm *VM) defineGlobal() {
-	address := int(vm.readByte())
-	identifier, _ := vm.peekFrame().Constants.At(address).Ptr.(string)
-	vm.globals[identifier] = vm.pop()
+	slot := int(vm.readByte())
+	vm.globals[slot] = global{Value: vm.pop(), defined: true}
 }
 
-func (vm *VM) divide() {
-	rhs, lhs := vm.getOperands()
-	v := Value{ValueType: Number, Float: lhs.Float / rhs.Float}
-	vm.push(v)
+func (vm *VM) complement() error {
+	v, err := Complement(*vm.top())
+	if err != nil {
+		return vm.error("%s", err)
+	}
+	*vm.top() = v
+	return nil
 }
 
 func (vm *VM) equality(op OpCode) error {
 	rhs, lhs := vm.getOperands()
+	equal, err := Equal(lhs, rhs)
+	if err != nil {
+		return vm.error("%s", err)
+	}
+	vm.push(Value{ValueType: Bool, Boolean: equal == (op == OpEqualEqual)})
+	return nil
+}
+
+func (vm *VM) getGlobal() error {
+	slot := int(vm.readByte())
+	if !vm.globals[slot].defined {
+		return vm.error("variable '%s' not defined", vm.symbols.Name(slot))
+	}
+	vm.push(vm.globals[slot].Value)
+	return nil
+}
 
-	err := fmt.Errorf("maki :: runtime error, invalid binary operands [line %d]", vm.getCurrentLine())
+func (vm *VM) getLocal() error {
+	address := int(vm.readByte())
+	vm.push(vm.stack[vm.peekFrame().locals+address])
+	return nil
+}
 
-	v := Value{ValueType: Bool, Boolean: true}
+// indexGet pops an index and the value it indexes and pushes the element at
+// that index.
+func (vm *VM) indexGet() error {
+	index, v := vm.pop(), vm.pop()
+	element, err := vm.element(v, index)
+	if err != nil {
+		return err
+	}
+	vm.push(element)
+	return nil
+}
 
-	if lhs.ValueType != rhs.ValueType {
-		if lhs.ValueType == Nil || rhs.ValueType == Nil {
-			if op == OpEqualEqual {
-				v.Boolean = false
-			}
-			vm.push(v)
-			return nil
-		} else {
-			return err
-		}
+// indexSet pops a value, an index and the value it indexes, sets the element
+// at that index and pushes the value back, as assignments are expressions.
+func (vm *VM) indexSet() error {
+	value := vm.pop()
+	index, v := vm.pop(), vm.pop()
+	if err := vm.setElement(v, index, value); err != nil {
+		return err
 	}
+	vm.push(value)
+	return nil
+}
 
-	switch lhs.ValueType {
-	case Bool:
-		v.Boolean = lhs.Boolean == rhs.Boolean
-	case Number:
-		v.Boolean = lhs.Float == rhs.Float
-	case Object:
+// element returns the element of v at index. Negative indexes count from the
+// end.
+func (vm *VM) element(v Value, index Value) (Value, error) {
+	if index.ValueType != Integer {
+		return Value{}, vm.error("invalid type for indexing: %s", index.TypeName())
+	}
+
+	switch v.ValueType {
+	case Array:
 		{
-			ls, ok := lhs.Ptr.(string)
+			array := *v.elements()
+			i, ok := position(int(index.Int), len(array))
 			if !ok {
-				return err
+				return Value{}, vm.error("index out of range with length %d: [%d]", len(array), index.Int)
 			}
-
-			rs, ok := rhs.Ptr.(string)
+			return array[i], nil
+		}
+	case String:
+		{
+			// strings are indexed by character
+			runes := []rune(v.Ptr.(string))
+			i, ok := position(int(index.Int), len(runes))
 			if !ok {
-				return err
+				return Value{}, vm.error("index out of range with length %d: [%d]", len(runes), index.Int)
 			}
-
-			v.Boolean = ls == rs
+			return NewString(string(runes[i])), nil
 		}
 	}
+	return Value{}, vm.error("cannot index value of type %s", v.TypeName())
+}
+
+// setElement sets the element of v at index. Negative indexes count from the
+// end.
+func (vm *VM) setElement(v Value, index Value, value Value) error {
+	if index.ValueType != Integer {
+		return vm.error("invalid type for indexing: %s", index.TypeName())
+	}
 
-	if op == OpNotEqual {
-		v.Boolean = !v.Boolean
+	switch v.ValueType {
+	case Array:
+		{
+			array := *v.elements()
+			i, ok := position(int(index.Int), len(array))
+			if !ok {
+				return vm.error("index out of range with length %d: [%d]", len(array), index.Int)
+			}
+			array[i] = value
+			return nil
+		}
+	case String:
+		return vm.error("cannot assign to an element of a string, strings are immutable")
 	}
+	return vm.error("cannot index value of type %s", v.TypeName())
+}
 
-	vm.push(v)
-	return nil
+// position returns the position of the element at index in a sequence of
+// length elements, counting from the end if index is negative, and whether
+// it is in range.
+func position(index, length int) (int, bool) {
+	if index < 0 {
+		index += length
+	}
+	return index, index >= 0 && index < length
 }
 
-func (vm *VM) getIndex() (int, error) {
-	v := vm.pop()
-	if v.ValueType != Number {
-		return 0, fmt.Errorf("maki :: runtime error, invalid type for indexing: %v", v.ValueType)
+func (vm *VM) getProperty() error {
+	name := vm.peekFrame().Constants.At(int(vm.readByte())).Ptr.(string)
+	v, err := Property(vm.pop(), name)
+	if err != nil {
+		return vm.error("%s", err)
 	}
-	return int(v.Float), nil
+	vm.push(v)
+	return nil
 }
 
-func (vm *VM) getGlobal(isIndexed bool) error {
-	address := int(vm.readByte())
-	identifier, _ := vm.peekFrame().Constants.At(address).Ptr.(string)
+// slice pops the bounds, which may be nil, and the string or the array to
+// slice. Negative bounds count from the end, slicing an array copies it.
+func (vm *VM) slice() error {
+	high, low, v := vm.pop(), vm.pop(), vm.pop()
 
-	variable, ok := vm.globals[identifier]
-	if !ok {
-		return fmt.Errorf("maki :: runtime error, variable '%s' not defined [line %d]", identifier, vm.getCurrentLine())
+	var length int
+	switch v.ValueType {
+	case Array:
+		length = len(*v.elements())
+	case String:
+		length = utf8.RuneCountInString(v.Ptr.(string))
+	default:
+		return vm.error("cannot slice value of type %s", v.TypeName())
 	}
 
-	if variable.ValueType == Array {
-		if isIndexed {
-			index, err := vm.getIndex()
-			if err != nil {
-				return err
-			}
-			array, ok := variable.Ptr.([]Value)
-			if !ok {
-				return fmt.Errorf("maki :: runtime error, variable '%s' is not a valid array", identifier)
-			}
-			if index >= len(array) {
-				return fmt.Errorf("maki :: runtume error, index out of range with length %d: %s[%d]", len(array), identifier, index)
-			}
-			variable = array[index]
-		} else {
-			variable = Value{ValueType: Reference, Ptr: variable}
-		}
+	from, err := vm.bound(low, 0, length)
+	if err != nil {
+		return err
+	}
+	to, err := vm.bound(high, length, length)
+	if err != nil {
+		return err
+	}
+	if from < 0 || to > length || from > to {
+		return vm.error("slice bounds out of range with length %d: [%d:%d]", length, from, to)
 	}
 
-	vm.push(variable)
+	if v.ValueType == Array {
+		vm.push(NewArray(append([]Value(nil), (*v.elements())[from:to]...)))
+	} else {
+		vm.push(NewString(string([]rune(v.Ptr.(string))[from:to])))
+	}
 	return nil
 }
 
-func (vm *VM) getLocal(isIndexed bool) error {
-	address := int(vm.readByte())
-	variable := vm.stack[vm.peekFrame().locals+address]
-
-	if variable.ValueType == Array {
-		if isIndexed {
-			index, err := vm.getIndex()
-			if err != nil {
-				return err
-			}
-			array, ok := variable.Ptr.([]Value)
-			if !ok {
-				return fmt.Errorf("maki :: runtime error, invalid array")
-			}
-			if index >= len(array) {
-				return fmt.Errorf("maki :: runtume error, index out of range with length %d: [%d]", len(array), index)
+// bound returns the bound of a slice of length elements, or def if it is
+// nil.
+func (vm *VM) bound(v Value, def, length int) (int, error) {
+	switch v.ValueType {
+	case Integer:
+		{
+			if v.Int < 0 {
+				return int(v.Int) + length, nil
 			}
-			variable = array[index]
-		} else {
-			variable = Value{ValueType: Reference, Ptr: variable}
+			return int(v.Int), nil
 		}
+	case Nil:
+		return def, nil
 	}
-
-	vm.push(variable)
-	return nil
+	return 0, vm.error("invalid type for slicing: %s", v.TypeName())
 }
 
 func (vm *VM) jump() {
@@ -493,112 +723,74 @@ func (vm *VM) array() {
 	for i := count - 1; i >= 0; i-- {
 		values[i] = vm.pop()
 	}
-	vm.push(Value{ValueType: Array, Ptr: values})
+	vm.push(NewArray(values))
+}
+
+func (vm *VM) concat() {
+	count := int(vm.readByte())
+	values := make([]Value, count)
+	for i := count - 1; i >= 0; i-- {
+		values[i] = vm.pop()
+	}
+	vm.push(Concat(values))
 }
 
 func (vm *VM) assert() error {
 	value := vm.pop()
 	if !value.Boolean {
-		return fmt.Errorf("maki :: assertion failed at line %d", vm.getCurrentLine())
+		return vm.error("assertion failed")
 	}
 	return nil
 }
 
-func (vm *VM) setGlobal(isIndexed bool) error {
+func (vm *VM) setGlobal() error {
 	value := vm.pop()
-	address := int(vm.readByte())
-	identifier, _ := vm.peekFrame().Constants.At(address).Ptr.(string)
-
-	if _, ok := vm.globals[identifier]; !ok {
-		return fmt.Errorf("maki :: runtime error, variable '%s' not defined [line %d]", identifier, vm.getCurrentLine())
-	}
-	variable := vm.globals[identifier]
-
-	if isIndexed && variable.ValueType == Array {
-		index, err := vm.getIndex()
-		if err != nil {
-			return err
-		}
-		array, ok := variable.Ptr.([]Value)
-		if !ok {
-			return fmt.Errorf("maki :: runtime error, variable '%s' is not a valid array")
-		}
-		if index >= len(array) {
-			return fmt.Errorf("maki :: runtume error, index out of range with length %d: %s[%d]", len(array), identifier, index)
-		}
-		array[index] = value
-	} else {
-		vm.globals[identifier] = value
+	slot := int(vm.readByte())
+	if !vm.globals[slot].defined {
+		return vm.error("variable '%s' not defined", vm.symbols.Name(slot))
 	}
+	vm.globals[slot].Value = value
 	vm.push(value)
 	return nil
 }
 
-func (vm *VM) setLocal(isIndexed bool) error {
+func (vm *VM) setLocal() error {
 	value := vm.pop()
-	address := int(vm.readByte())
-	variable := vm.stack[address]
+	address := vm.peekFrame().locals + int(vm.readByte())
+	vm.stack[address] = value
+	vm.push(value)
+	return nil
+}
 
-	if isIndexed && value.ValueType == Array {
-		index, err := vm.getIndex()
-		if err != nil {
-			return err
-		}
-		array, ok := variable.Ptr.([]Value)
-		if !ok {
-			return fmt.Errorf("maki :: runtime error, invalid array")
-		}
-		if index >= len(array) {
-			return fmt.Errorf("maki :: runtume error, index out of range with length %d: [%d]", len(array), index)
-		}
-		array[index] = value
-	} else {
-		vm.stack[address] = value
+func (vm *VM) membership() error {
+	container, v := vm.getOperands()
+	in, err := Contains(container, v)
+	if err != nil {
+		return vm.error("%s", err)
 	}
-	vm.push(value)
+	vm.push(in)
 	return nil
 }
 
 func (vm *VM) comparison(op OpCode) error {
 	rhs, lhs := vm.getOperands()
-
-	if lhs.ValueType != Number || rhs.ValueType != Number {
-		return fmt.Errorf("maki :: runtime error, invalid binary operands [line %d]", vm.getCurrentLine())
-	}
-
-	v := Value{ValueType: Bool}
-	switch op {
-	case OpGreater:
-		v.Boolean = lhs.Float > rhs.Float
-	case OpGreaterEqual:
-		v.Boolean = lhs.Float >= rhs.Float
-	case OpLess:
-		v.Boolean = lhs.Float < rhs.Float
-	case OpLessEqual:
-		v.Boolean = lhs.Float <= rhs.Float
+	v, err := Compare(op, lhs, rhs)
+	if err != nil {
+		return vm.error("%s", err)
 	}
-
 	vm.push(v)
 	return nil
 }
 
 func (vm *VM) minus() error {
-	v := vm.top()
-
-	if v.ValueType != Number {
-		return fmt.Errorf("maki :: runtime error, operand must be a number [line %d]", vm.getCurrentLine())
+	v, err := Negate(*vm.top())
+	if err != nil {
+		return vm.error("%s", err)
 	}
-
-	v.Float = -v.Float
+	*vm.top() = v
 	return nil
 }
 
-func (vm *VM) multiply() {
-	rhs, lhs := vm.getOperands()
-	v := Value{ValueType: Number, Float: lhs.Float * rhs.Float}
-	vm.push(v)
-}
-
 func (vm *VM) nil() {
 	v := Value{ValueType: Nil}
 	vm.push(v)
@@ -621,23 +813,22 @@ func (vm *VM) not() {
 	}
 }
 
-func (vm *VM) subtract() {
-	rhs, lhs := vm.getOperands()
-	v := Value{
-		ValueType: Number,
-		Float:     lhs.Float - rhs.Float,
-	}
-	vm.push(v)
-}
-
 func (vm *VM) getOperands() (Value, Value) {
 	return vm.pop(), vm.pop()
 }
 
-func (vm *VM) getCurrentLine() int {
-	line, err := vm.peekFrame().Lines.At(vm.ip)
+// error returns a runtime error located at the instruction being executed.
+func (vm *VM) error(format string, args ...interface{}) *Error {
+	frame := vm.peekFrame()
+
+	span, err := frame.Span(vm.op)
 	if err != nil {
 		panic(err.Error())
 	}
-	return line
+
+	return &Error{
+		Span:    span,
+		Message: fmt.Sprintf(format, args...),
+		Source:  frame.Source,
+	}
 }
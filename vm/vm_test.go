@@ -0,0 +1,199 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestVM_Stdout(t *testing.T) {
+	tcs := []struct {
+		name   string
+		values []Value
+		output string
+	}{
+		{
+			name:   "Print Integer",
+			values: []Value{{ValueType: Integer, Int: 42}},
+			output: "42\n",
+		},
+		{
+			name:   "Print Float",
+			values: []Value{{ValueType: Number, Float: 42}},
+			output: "42.0\n",
+		},
+		{
+			name:   "Print Many",
+			values: []Value{{ValueType: Bool, Boolean: true}, {ValueType: Nil}, NewString("Maki")},
+			output: "true\nnil\nMaki\n",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			fun := NewFunction("MAIN")
+			for _, v := range tc.values {
+				fun.WriteConstant(v, Span{Line: 1})
+				fun.Write(OpPrint, Span{Line: 1})
+			}
+			fun.Write(OpTerminate, Span{Line: 1})
+
+			var stdout bytes.Buffer
+			if err := NewVM(Stdout(&stdout)).Run(fun); err != nil {
+				t.Fatalf("got %v, want nil", err.Error())
+			}
+
+			if stdout.String() != tc.output {
+				t.Errorf("got %q, want %q", stdout.String(), tc.output)
+			}
+		})
+	}
+}
+
+func TestVM_Bind(t *testing.T) {
+	// two programs compiled with their own table of globals
+	define := NewFunction("MAIN")
+	define.Symbols = NewSymbols()
+	define.Symbols.Slot("unused")
+	define.WriteConstant(NewString("Maki"), Span{Line: 1})
+	define.Write(OpDefineGlobal, Span{Line: 1})
+	define.Write(OpCode(define.Symbols.Slot("name")), Span{Line: 1})
+	define.Write(OpTerminate, Span{Line: 1})
+
+	read := NewFunction("MAIN")
+	read.Symbols = NewSymbols()
+	read.Write(OpGetGlobal, Span{Line: 1})
+	read.Write(OpCode(read.Symbols.Slot("name")), Span{Line: 1})
+	read.Write(OpPrint, Span{Line: 1})
+	read.Write(OpTerminate, Span{Line: 1})
+
+	var stdout bytes.Buffer
+	vm := NewVM(Stdout(&stdout))
+	for _, fun := range []*Function{define, read} {
+		if err := vm.Run(fun); err != nil {
+			t.Fatalf("got %v, want nil", err.Error())
+		}
+	}
+
+	if stdout.String() != "Maki\n" {
+		t.Errorf("got %q, want %q", stdout.String(), "Maki\n")
+	}
+}
+
+func TestVM_Natives(t *testing.T) {
+	tcs := []struct {
+		name   string
+		native string
+		args   []Value
+		input  string
+		output string
+		err    string
+	}{
+		{
+			name:   "Println",
+			native: "println",
+			args:   []Value{NewString("Hello, "), NewString("Maki!")},
+			output: "Hello, Maki!\n",
+		},
+		{
+			name:   "Readln",
+			native: "readln",
+			input:  "Maki\nignored\n",
+			output: "Maki\n",
+		},
+		{
+			name:   "Readln EOF",
+			native: "readln",
+			input:  "",
+			output: "nil\n",
+		},
+		{
+			name:   "Len",
+			native: "len",
+			args:   []Value{NewString("Mäki")},
+			output: "4\n",
+		},
+		{
+			name:   "Len Array",
+			native: "len",
+			args:   []Value{NewArray([]Value{{ValueType: Nil}, NewString("Maki")})},
+			output: "2\n",
+		},
+		{
+			name:   "Copy",
+			native: "copy",
+			args:   []Value{NewArray([]Value{NewString("Maki"), NewArray(nil)})},
+			output: "[ Maki, [] ]\n",
+		},
+		{
+			name:   "Copy Not An Array",
+			native: "copy",
+			args:   []Value{NewString("Maki")},
+			output: "Maki\n",
+		},
+		{
+			name:   "Len Not A String",
+			native: "len",
+			args:   []Value{{ValueType: Integer, Int: 42}},
+			err:    "len expects an array or a string, got int",
+		},
+		{
+			name:   "Len Without Arguments",
+			native: "len",
+			err:    "len expects 1 argument, got 0",
+		},
+		{
+			name:   "Copy Without Arguments",
+			native: "copy",
+			err:    "copy expects 1 argument, got 0",
+		},
+		{
+			name:   "Big Integer Of Two Arguments",
+			native: "bigint",
+			args:   []Value{NewString("1"), NewString("2")},
+			err:    "bigint expects 1 argument, got 2",
+		},
+		{
+			name:   "Decimal Without Arguments",
+			native: "decimal",
+			err:    "decimal expects 1 argument, got 0",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			fun := NewFunction("MAIN")
+			fun.Symbols = NewSymbols()
+			fun.Write(OpGetGlobal, Span{Line: 1})
+			fun.Write(OpCode(fun.Symbols.Slot(tc.native)), Span{Line: 1})
+			for _, v := range tc.args {
+				fun.WriteConstant(v, Span{Line: 1})
+			}
+			fun.Write(OpCall, Span{Line: 1})
+			fun.Write(OpCode(len(tc.args)), Span{Line: 1})
+			if tc.native == "println" {
+				fun.Write(OpPop, Span{Line: 1})
+			} else {
+				fun.Write(OpPrint, Span{Line: 1})
+			}
+			fun.Write(OpTerminate, Span{Line: 1})
+
+			var stdout bytes.Buffer
+			vm := NewVM(Stdin(strings.NewReader(tc.input)), Stdout(&stdout))
+			err := vm.Run(fun)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got %v, want %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want nil", err.Error())
+			}
+
+			if stdout.String() != tc.output {
+				t.Errorf("got %q, want %q", stdout.String(), tc.output)
+			}
+		})
+	}
+}